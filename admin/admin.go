@@ -0,0 +1,52 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Local HTTP endpoint the function and support tooling can query for extension state.
+// It only listens on the configured address, normally on the loopback interface.
+type Server struct {
+	address string
+	mux     *http.ServeMux
+}
+
+func New(address string) *Server {
+	return &Server{
+		address: address,
+		mux:     http.NewServeMux(),
+	}
+}
+
+// Serves the value returned by fn as JSON. Returning nil responds with 404.
+func (s *Server) HandleJSON(pattern string, fn func(r *http.Request) interface{}) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		value := fn(r)
+		if value == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(value)
+		if err != nil {
+			log.Println("[admin:HandleJSON] Failed to write response:", err)
+		}
+	})
+}
+
+// Serves a handler that writes its own response, e.g. a stream
+func (s *Server) Handle(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// Starts listening in a goroutine
+func (s *Server) Start() {
+	go func() {
+		err := http.ListenAndServe(s.address, s.mux)
+		if err != nil {
+			log.Println("[admin:Start] Admin endpoint stopped:", err)
+		}
+	}()
+}
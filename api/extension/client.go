@@ -12,6 +12,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
 // RegisterResponse is the body of the response for /register
@@ -19,6 +21,10 @@ type RegisterResponse struct {
 	FunctionName    string `json:"functionName"`
 	FunctionVersion string `json:"functionVersion"`
 	Handler         string `json:"handler"`
+	// Only returned when the accountId feature was accepted on registration
+	AccountID string `json:"accountId,omitempty"`
+	// Taken from the Lambda-Extension-Identifier header
+	ExtensionID string `json:"-"`
 }
 
 // NextEventResponse is the response for /event/next
@@ -28,8 +34,27 @@ type NextEventResponse struct {
 	RequestID          string    `json:"requestId"`
 	InvokedFunctionArn string    `json:"invokedFunctionArn"`
 	Tracing            Tracing   `json:"tracing"`
+	// Only set for SHUTDOWN events
+	ShutdownReason ShutdownReason `json:"shutdownReason,omitempty"`
 }
 
+// Time by which the invocation, or the extension's shutdown, has to complete
+func (r *NextEventResponse) Deadline() time.Time {
+	return time.UnixMilli(r.DeadlineMs)
+}
+
+// ShutdownReason explains why the sandbox is shut down
+type ShutdownReason string
+
+const (
+	// The sandbox is recycled after being idle, telemetry has been delivered normally
+	ShutdownSpindown ShutdownReason = "spindown"
+	// The function or an extension exceeded its time
+	ShutdownTimeout ShutdownReason = "timeout"
+	// The runtime or an extension crashed, e.g. ran out of memory
+	ShutdownFailure ShutdownReason = "failure"
+)
+
 // Tracing is part of the response for /event/next
 type Tracing struct {
 	Type  string `json:"type"`
@@ -41,6 +66,40 @@ type StatusResponse struct {
 	Status string `json:"status"`
 }
 
+// ErrorRequest is the optional body of /init/error and /exit/error describing the failure
+type ErrorRequest struct {
+	ErrorMessage string   `json:"errorMessage"`
+	ErrorType    string   `json:"errorType"`
+	StackTrace   []string `json:"stackTrace,omitempty"`
+}
+
+// StatusError is returned when Extensions API rejects a request. 4xx responses mean the
+// request was invalid, e.g. an unknown extension identifier, 5xx that the platform failed
+// and the extension should exit.
+type StatusError struct {
+	StatusCode   int    `json:"-"`
+	Status       string `json:"-"`
+	ErrorType    string `json:"errorType"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+func (e *StatusError) Error() string {
+	if e.ErrorType == "" {
+		return fmt.Sprintf("request failed with status %s", e.Status)
+	}
+	return fmt.Sprintf("request failed with status %s: %s %s", e.Status, e.ErrorType, e.ErrorMessage)
+}
+
+// Reports whether the request was rejected as invalid
+func (e *StatusError) ClientError() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500
+}
+
+// Reports whether the platform failed to handle the request
+func (e *StatusError) ServerError() bool {
+	return e.StatusCode >= 500
+}
+
 // EventType represents the type of events recieved from /event/next
 type EventType string
 
@@ -52,137 +111,206 @@ const (
 	extensionErrorType                 = "Lambda-Extension-Function-Error-Type"
 )
 
-var baseUrl = fmt.Sprintf("http://%s/2020-01-01/extension", os.Getenv("AWS_LAMBDA_RUNTIME_API"))
-var client = &http.Client{}
-var extensionID string
+const extensionAcceptFeatureHeader = "Lambda-Extension-Accept-Feature"
+
+// Feature adding the function's account id to RegisterResponse
+const AcceptAccountID = "accountId"
+
+// RegisterOptions configures the registration with Extensions API
+type RegisterOptions struct {
+	// Name of the extension, it must match the file name of the executable in /opt/extensions. Defaults to "sst"
+	Name string
+	// Events the extension receives from /event/next. Nil subscribes to INVOKE and SHUTDOWN,
+	// []EventType{Shutdown} runs the extension in logs-only mode
+	Events []EventType
+	// Optional features requested from the platform, e.g. AcceptAccountID
+	AcceptFeatures []string
+}
+
+// API is the subset of Extensions API the extension relies on, implemented by Client
+type API interface {
+	Register(ctx context.Context, options RegisterOptions) (*RegisterResponse, error)
+	EventNext(ctx context.Context) (*NextEventResponse, context.Context, context.CancelFunc, error)
+	InitError(ctx context.Context, errorType string, report *ErrorRequest) (*StatusResponse, error)
+	ExitError(ctx context.Context, errorType string, report *ErrorRequest) (*StatusResponse, error)
+}
+
+// ClientOptions configures a Client
+type ClientOptions struct {
+	// Defaults to the Extensions API of the sandbox, derived from AWS_LAMBDA_RUNTIME_API
+	BaseURL string
+	// Applies to every request, including the long poll of /event/next. Zero means no timeout
+	Timeout time.Duration
+	// Defaults to http.DefaultTransport
+	Transport http.RoundTripper
+	// Subtracted from an event's deadline for the context returned by EventNext
+	DeadlineMargin time.Duration
+}
+
+// The client used for talking to Extensions API. It remembers the identifier returned by Register
+type Client struct {
+	httpClient     *http.Client
+	baseUrl        string
+	extensionID    string
+	deadlineMargin time.Duration
+}
+
+var _ API = (*Client)(nil)
+
+func NewClient(options ClientOptions) *Client {
+	baseUrl := options.BaseURL
+	if baseUrl == "" {
+		baseUrl = fmt.Sprintf("http://%s/2020-01-01/extension", os.Getenv("AWS_LAMBDA_RUNTIME_API"))
+	}
+	return &Client{
+		httpClient: &http.Client{
+			Timeout:   options.Timeout,
+			Transport: options.Transport,
+		},
+		baseUrl:        strings.TrimSuffix(baseUrl, "/"),
+		deadlineMargin: options.DeadlineMargin,
+	}
+}
+
+// Identifier assigned on registration, empty before Register succeeds
+func (c *Client) ExtensionID() string {
+	return c.extensionID
+}
 
 // Registers the extension with Extensions API
-func Register(ctx context.Context) (string, error) {
-	url := baseUrl + "/register"
+func (c *Client) Register(ctx context.Context, options RegisterOptions) (*RegisterResponse, error) {
+	url := c.baseUrl + "/register"
 
+	if options.Name == "" {
+		options.Name = "sst"
+	}
+	if options.Events == nil {
+		options.Events = []EventType{Invoke, Shutdown}
+	}
 	body, err := json.Marshal(map[string]interface{}{
-		"events": []EventType{Invoke, Shutdown},
+		"events": options.Events,
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	req.Header.Set(extensionNameHeader, options.Name)
+	if len(options.AcceptFeatures) > 0 {
+		req.Header.Set(extensionAcceptFeatureHeader, strings.Join(options.AcceptFeatures, ","))
 	}
-	req.Header.Set(extensionNameHeader, "sst")
 
-	res, err := client.Do(req)
+	res, err := c.httpClient.Do(req)
 	if err != nil {
 		log.Println("[client:Register] Registration failed", err)
-		return "", err
-	}
-
-	if res.StatusCode != 200 {
-		log.Println("[client:Register] Registration failed with statusCode ", res)
-		return "", fmt.Errorf("registration failed with status %s", res.Status)
+		return nil, err
 	}
 
 	defer res.Body.Close()
 	bytes, err := io.ReadAll(res.Body)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		log.Println("[client:Register] Registration failed with statusCode ", res)
+		statusErr := &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+		_ = json.Unmarshal(bytes, statusErr)
+		return nil, fmt.Errorf("registration failed: %w", statusErr)
 	}
 
 	out := RegisterResponse{}
 	err = json.Unmarshal(bytes, &out)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	extensionID = res.Header.Get(extensionIdentiferHeader)
-	return extensionID, nil
+	c.extensionID = res.Header.Get(extensionIdentiferHeader)
+	out.ExtensionID = c.extensionID
+	return &out, nil
 }
 
-// Blocks while long polling for the next Lambda invoke or shutdown
-func EventNext(ctx context.Context) (*NextEventResponse, error) {
-	url := baseUrl + "/event/next"
+// Blocks while long polling for the next Lambda invoke or shutdown.
+//
+// The returned context is derived from ctx and cancelled at the event's deadline minus
+// the client's DeadlineMargin, so work bounded by it never holds up the sandbox freeze.
+// Call the cancel function once the event is handled.
+func (c *Client) EventNext(ctx context.Context) (*NextEventResponse, context.Context, context.CancelFunc, error) {
+	url := c.baseUrl + "/event/next"
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
-	req.Header.Set(extensionIdentiferHeader, extensionID)
-	res, err := client.Do(req)
+	req.Header.Set(extensionIdentiferHeader, c.extensionID)
+	res, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
-	}
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("request failed with status %s", res.Status)
+		return nil, nil, nil, err
 	}
 	defer res.Body.Close()
 	byes, err := io.ReadAll(res.Body)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
+	}
+	if res.StatusCode != 200 {
+		statusErr := &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+		_ = json.Unmarshal(byes, statusErr)
+		return nil, nil, nil, statusErr
 	}
 	out := NextEventResponse{}
 	err = json.Unmarshal(byes, &out)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
-	return &out, nil
+	eventCtx, cancel := context.WithDeadline(ctx, out.Deadline().Add(-c.deadlineMargin))
+	return &out, eventCtx, cancel, nil
 }
 
 // Reports an initialization error to the platform. Call it when you registered but failed to initialize
-func InitError(errorType string) (*StatusResponse, error) {
-	url := baseUrl + "/init/error"
-
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set(extensionIdentiferHeader, extensionID)
-	req.Header.Set(extensionErrorType, errorType)
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("request failed with status %s", res.Status)
-	}
-	defer res.Body.Close()
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
-	}
-	out := StatusResponse{}
-	err = json.Unmarshal(body, &out)
-	if err != nil {
-		return nil, err
-	}
-	return &out, nil
+func (c *Client) InitError(ctx context.Context, errorType string, report *ErrorRequest) (*StatusResponse, error) {
+	return c.reportError(ctx, "/init/error", errorType, report)
 }
 
 // Reports an error to the platform before exiting. Call it when you encounter an unexpected failure
-func ExitError(errorType string) (*StatusResponse, error) {
-	url := baseUrl + "/exit/error"
+func (c *Client) ExitError(ctx context.Context, errorType string, report *ErrorRequest) (*StatusResponse, error) {
+	return c.reportError(ctx, "/exit/error", errorType, report)
+}
+
+func (c *Client) reportError(ctx context.Context, path string, errorType string, report *ErrorRequest) (*StatusResponse, error) {
+	url := c.baseUrl + path
 
-	req, err := http.NewRequest("POST", url, nil)
+	var body io.Reader
+	if report != nil {
+		data, err := json.Marshal(report)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set(extensionIdentiferHeader, extensionID)
+	req.Header.Set(extensionIdentiferHeader, c.extensionID)
 	req.Header.Set(extensionErrorType, errorType)
-	res, err := client.Do(req)
+	res, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("request failed with status %s", res.Status)
-	}
 	defer res.Body.Close()
-	body, err := io.ReadAll(res.Body)
+	data, err := io.ReadAll(res.Body)
 	if err != nil {
 		return nil, err
 	}
+	if res.StatusCode != 200 {
+		statusErr := &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+		_ = json.Unmarshal(data, statusErr)
+		return nil, statusErr
+	}
 	out := StatusResponse{}
-	err = json.Unmarshal(body, &out)
+	err = json.Unmarshal(data, &out)
 	if err != nil {
 		return nil, err
 	}
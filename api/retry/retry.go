@@ -0,0 +1,51 @@
+package retry
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// How often and how patiently a failing call to the Runtime API or a sink is retried
+type Policy struct {
+	// Total number of calls, including the first one. Values below 1 mean a single call
+	MaxAttempts int
+	// Upper bound of the delay before the first retry, doubled after every attempt
+	InitialDelay time.Duration
+	// Cap on the delay between two attempts
+	MaxDelay time.Duration
+	// Reports whether an error is worth another attempt, nil retries every error
+	Retryable func(error) bool
+}
+
+// Calls fn until it succeeds, the attempts are exhausted or ctx is done, returning the
+// last error. Delays are drawn uniformly up to the current backoff (full jitter) so
+// extensions in many sandboxes don't retry in lockstep. No attempt is waited for that
+// couldn't start before ctx's deadline.
+func (p Policy) Do(ctx context.Context, name string, fn func() error) error {
+	delay := p.InitialDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+		if p.Retryable != nil && !p.Retryable(err) {
+			return err
+		}
+		wait := time.Duration(0)
+		if delay > 0 {
+			wait = time.Duration(rand.Int63n(int64(delay)) + 1)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return err
+		}
+		log.Printf("[retry:%s] Attempt %d failed, retrying in %v: %v", name, attempt, wait, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, p.MaxDelay)
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 	"net/http"
 	"os"
+	"sync"
 )
 
 const lambdaAgentIdentifierHeaderKey string = "Lambda-Extension-Identifier"
@@ -21,13 +22,40 @@ const lambdaAgentIdentifierHeaderKey string = "Lambda-Extension-Identifier"
 type Client struct {
 	httpClient *http.Client
 	baseUrl    string
+	logsUrl    string
+	mu         sync.Mutex
+	negotiated *Negotiated
 }
 
-func NewClient() *Client {
+// What the last successful subscription settled on
+type Negotiated struct {
+	// telemetry, or logs after falling back to the Logs API
+	API           string        `json:"api"`
+	SchemaVersion SchemaVersion `json:"schemaVersion"`
+	Protocol      HttpProtocol  `json:"protocol"`
+	Types         []EventType   `json:"types"`
+}
+
+// Returns nil until a subscription succeeded
+func (c *Client) Negotiated() *Negotiated {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.negotiated
+}
+
+// ClientOptions configures a Client
+type ClientOptions struct {
+	// Defaults to http.DefaultTransport
+	Transport http.RoundTripper
+}
+
+func NewClient(options ClientOptions) *Client {
 	baseUrl := fmt.Sprintf("http://%s/2022-07-01/telemetry", os.Getenv("AWS_LAMBDA_RUNTIME_API"))
+	logsUrl := fmt.Sprintf("http://%s/2020-08-15/logs", os.Getenv("AWS_LAMBDA_RUNTIME_API"))
 	return &Client{
-		httpClient: &http.Client{},
+		httpClient: &http.Client{Transport: options.Transport},
 		baseUrl:    baseUrl,
+		logsUrl:    logsUrl,
 	}
 }
 
@@ -50,7 +78,7 @@ type BufferingCfg struct {
 	MaxItems uint32 `json:"maxItems"`
 	// Maximum size in bytes of the log events to be buffered in memory. (default: 262144, minimum: 262144, maximum: 1048576)
 	MaxBytes uint32 `json:"maxBytes"`
-	// Maximum time (in milliseconds) for a batch to be buffered. (default: 1000, minimum: 100, maximum: 30000)
+	// Maximum time (in milliseconds) for a batch to be buffered. (default: 1000, minimum: 25, maximum: 30000)
 	TimeoutMS uint32 `json:"timeoutMs"`
 }
 
@@ -72,6 +100,8 @@ type HttpProtocol string
 
 const (
 	HttpProto HttpProtocol = "HTTP"
+	// Events are streamed as newline delimited JSON over a long lived connection
+	TcpProto HttpProtocol = "TCP"
 )
 
 // Denotes what the content is encoded in
@@ -81,21 +111,29 @@ const (
 	JSON HttpEncoding = "JSON"
 )
 
-// Configuration for listeners that would like to receive telemetry via HTTP
+// Configuration for listeners that would like to receive telemetry via HTTP or TCP.
+// HTTP destinations set URI, method and encoding, TCP ones only the port.
 type Destination struct {
 	Protocol   HttpProtocol `json:"protocol"`
-	URI        URI          `json:"URI"`
-	HttpMethod HttpMethod   `json:"method"`
-	Encoding   HttpEncoding `json:"encoding"`
+	URI        URI          `json:"URI,omitempty"`
+	HttpMethod HttpMethod   `json:"method,omitempty"`
+	Encoding   HttpEncoding `json:"encoding,omitempty"`
+	Port       int          `json:"port,omitempty"`
 }
 
 type SchemaVersion string
 
 const (
 	SchemaVersion20220701 = "2022-07-01"
-	SchemaVersionLatest   = SchemaVersion20220701
+	SchemaVersion20221213 = "2022-12-13"
+	SchemaVersionLatest   = SchemaVersion20221213
+	// Schema of the Logs API, used when the Telemetry API isn't available
+	SchemaVersionLogs20210318 = "2021-03-18"
 )
 
+// Telemetry API schemas tried on subscribe, newest first
+var SchemaVersions = []SchemaVersion{SchemaVersion20221213, SchemaVersion20220701}
+
 // Request body that is sent to the Telemetry API on subscribe
 type SubscribeRequest struct {
 	SchemaVersion SchemaVersion `json:"schemaVersion"`
@@ -107,20 +145,39 @@ type SubscribeRequest struct {
 // Response body that is received from the Telemetry API on subscribe
 type SubscribeResponse struct {
 	body string
+	// Set when the subscription went to the Logs API instead
+	Legacy bool
+	// Schema the API accepted, events are delivered in it
+	SchemaVersion SchemaVersion
+}
+
+// Options for a Telemetry API subscription
+type SubscribeOptions struct {
+	// Zero fields fall back to 1000 items, 256 KiB and 1000 ms
+	Buffering BufferingCfg
+	// Defaults to Platform and Function
+	Types []EventType
+	// Defaults to HttpProto. With TcpProto the listener URI is ignored in favour of Port.
+	Protocol HttpProtocol
+	Port     int
 }
 
 // Subscribes to the Telemetry API to start receiving the log events
-func (c *Client) Subscribe(ctx context.Context, extensionId string, listenerUri string) (*SubscribeResponse, error) {
-	eventTypes := []EventType{
-		Platform,
-		Function,
-		// Extension,
+func (c *Client) Subscribe(ctx context.Context, extensionId string, listenerUri string, options SubscribeOptions) (*SubscribeResponse, error) {
+	eventTypes := options.Types
+	if len(eventTypes) == 0 {
+		eventTypes = []EventType{Platform, Function}
 	}
 
-	bufferingConfig := BufferingCfg{
-		MaxItems:  1000,
-		MaxBytes:  256 * 1024,
-		TimeoutMS: 1000,
+	bufferingConfig := options.Buffering
+	if bufferingConfig.MaxItems == 0 {
+		bufferingConfig.MaxItems = 1000
+	}
+	if bufferingConfig.MaxBytes == 0 {
+		bufferingConfig.MaxBytes = 256 * 1024
+	}
+	if bufferingConfig.TimeoutMS == 0 {
+		bufferingConfig.TimeoutMS = 1000
 	}
 
 	destination := Destination{
@@ -129,26 +186,73 @@ func (c *Client) Subscribe(ctx context.Context, extensionId string, listenerUri
 		Encoding:   JSON,
 		URI:        URI(listenerUri),
 	}
+	if options.Protocol == TcpProto {
+		destination = Destination{
+			Protocol: TcpProto,
+			Port:     options.Port,
+		}
+	}
 
-	data, err := json.Marshal(
-		&SubscribeRequest{
-			SchemaVersion: SchemaVersionLatest,
-			EventTypes:    eventTypes,
-			BufferingCfg:  bufferingConfig,
-			Destination:   destination,
-		})
+	request := &SubscribeRequest{
+		EventTypes:   eventTypes,
+		BufferingCfg: bufferingConfig,
+		Destination:  destination,
+	}
+	var response *SubscribeResponse
+	var status int
+	var err error
+	for _, version := range SchemaVersions {
+		request.SchemaVersion = version
+		response, status, err = c.subscribe(ctx, c.baseUrl, extensionId, request)
+		// An unknown schema is rejected as a bad request, older sandboxes may predate the newest
+		if status != http.StatusBadRequest {
+			break
+		}
+		log.Println("[client:Subscribe] Schema", version, "rejected, trying an older one")
+	}
+	if status == http.StatusNotFound {
+		// Runtimes and regions without the Telemetry API still serve the Logs API, which
+		// takes the same request and delivers the same event types in an older schema
+		log.Println("[client:Subscribe] Telemetry API not found, falling back to the Logs API")
+		request.SchemaVersion = SchemaVersionLogs20210318
+		response, _, err = c.subscribe(ctx, c.logsUrl, extensionId, request)
+		if response != nil {
+			response.Legacy = true
+		}
+	}
+	if response != nil {
+		response.SchemaVersion = request.SchemaVersion
+		negotiated := &Negotiated{
+			API:           "telemetry",
+			SchemaVersion: request.SchemaVersion,
+			Protocol:      destination.Protocol,
+			Types:         eventTypes,
+		}
+		if response.Legacy {
+			negotiated.API = "logs"
+		}
+		log.Println("[client:Subscribe] Subscribed to the", negotiated.API, "API with schema", negotiated.SchemaVersion)
+		c.mu.Lock()
+		c.negotiated = negotiated
+		c.mu.Unlock()
+	}
+	return response, err
+}
 
+// Sends a subscription request, returning the status code alongside any failure
+func (c *Client) subscribe(ctx context.Context, url string, extensionId string, request *SubscribeRequest) (*SubscribeResponse, int, error) {
+	data, err := json.Marshal(request)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	headers := make(map[string]string)
 	headers[lambdaAgentIdentifierHeaderKey] = extensionId
 
-	resp, err := httpPutWithHeaders(ctx, c.httpClient, c.baseUrl, data, &headers)
+	resp, err := httpPutWithHeaders(ctx, c.httpClient, url, data, &headers)
 	if err != nil {
 		log.Println("[client:Subscribe] Subscription failed:", err)
-		return nil, err
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 
@@ -158,15 +262,15 @@ func (c *Client) Subscribe(ctx context.Context, extensionId string, listenerUri
 		log.Println("[client:Subscribe] Subscription failed")
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			return nil, fmt.Errorf("%s failed: %d[%s]", c.baseUrl, resp.StatusCode, resp.Status)
+			return nil, resp.StatusCode, fmt.Errorf("%s failed: %d[%s]", url, resp.StatusCode, resp.Status)
 		}
 
-		return nil, fmt.Errorf("%s failed: %d[%s] %s", c.baseUrl, resp.StatusCode, resp.Status, string(body))
+		return nil, resp.StatusCode, fmt.Errorf("%s failed: %d[%s] %s", url, resp.StatusCode, resp.Status, string(body))
 	}
 
 	body, _ := ioutil.ReadAll(resp.Body)
 
-	return &SubscribeResponse{string(body)}, nil
+	return &SubscribeResponse{body: string(body)}, resp.StatusCode, nil
 }
 
 func httpPutWithHeaders(ctx context.Context, client *http.Client, url string, data []byte, headers *map[string]string) (*http.Response, error) {
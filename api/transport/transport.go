@@ -0,0 +1,33 @@
+package transport
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// Connection settings for the Runtime API clients
+type Options struct {
+	// Idle connections kept per host, zero keeps the net/http default of 2
+	MaxIdleConnsPerHost int
+	// How long an idle connection is kept. Zero keeps it forever, which avoids reconnecting
+	// for every /event/next poll after a sandbox sat frozen longer than the net/http default
+	IdleConnTimeout time.Duration
+	// Time to wait for response headers, zero for no limit. /event/next only answers when
+	// the next event arrives, so anything but zero fails idle polls of the extension client
+	ResponseHeaderTimeout time.Duration
+}
+
+// Builds a transport for the local Runtime API. Proxy environment variables are ignored,
+// the Runtime API is only reachable inside the sandbox.
+func New(options Options) *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConnsPerHost:   options.MaxIdleConnsPerHost,
+		IdleConnTimeout:       options.IdleConnTimeout,
+		ResponseHeaderTimeout: options.ResponseHeaderTimeout,
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/appconfigdata"
+	"github.com/sst/extension/config"
+)
+
+// Limit on each call to the AppConfigData API
+const appConfigTimeout = 10 * time.Second
+
+// Pulls the extension's configuration profile from AppConfig through the AppConfigData
+// API. AppConfig only returns the profile when it changed since the previous poll.
+type appConfigPoller struct {
+	settings config.AppConfig
+	client   *appconfigdata.Client
+	// Token of the next poll, handed out by the previous one
+	token string
+	// Shortest interval AppConfig asked for between polls
+	interval time.Duration
+}
+
+func newAppConfigPoller(cfg aws.Config, settings config.AppConfig) *appConfigPoller {
+	return &appConfigPoller{
+		settings: settings,
+		client:   appconfigdata.NewFromConfig(cfg),
+		interval: settings.Interval,
+	}
+}
+
+// Returns the profile if it changed since the previous call, nil otherwise
+func (p *appConfigPoller) Poll(ctx context.Context) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, appConfigTimeout)
+	defer cancel()
+	if p.token == "" {
+		if err := p.start(ctx); err != nil {
+			return nil, err
+		}
+	}
+	out, err := p.client.GetLatestConfiguration(ctx, &appconfigdata.GetLatestConfigurationInput{
+		ConfigurationToken: aws.String(p.token),
+	})
+	if err != nil {
+		// An expired token starts a new session on the next poll
+		p.token = ""
+		return nil, err
+	}
+	p.token = aws.ToString(out.NextPollConfigurationToken)
+	if out.NextPollIntervalInSeconds > 0 {
+		p.interval = max(p.settings.Interval, time.Duration(out.NextPollIntervalInSeconds)*time.Second)
+	}
+	if len(out.Configuration) == 0 {
+		return nil, nil
+	}
+	return out.Configuration, nil
+}
+
+// Starts a configuration session, which hands out the token of the first poll
+func (p *appConfigPoller) start(ctx context.Context) error {
+	out, err := p.client.StartConfigurationSession(ctx, &appconfigdata.StartConfigurationSessionInput{
+		ApplicationIdentifier:                aws.String(p.settings.Application),
+		EnvironmentIdentifier:                aws.String(p.settings.Environment),
+		ConfigurationProfileIdentifier:       aws.String(p.settings.Profile),
+		RequiredMinimumPollIntervalInSeconds: aws.Int32(int32(p.settings.Interval / time.Second)),
+	})
+	if err != nil {
+		return err
+	}
+	p.token = aws.ToString(out.InitialConfigurationToken)
+	return nil
+}
+
+// Polls in the background until ctx is done, handing out changed profiles. Only the
+// latest one is kept until it is taken.
+func (p *appConfigPoller) Watch(ctx context.Context) <-chan []byte {
+	updates := make(chan []byte, 1)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(p.interval):
+			}
+			document, err := p.Poll(ctx)
+			if err != nil {
+				log.Println("[appconfig:poll] Failed to poll AppConfig:", err)
+				continue
+			}
+			if document == nil {
+				continue
+			}
+			select {
+			case <-updates:
+			default:
+			}
+			updates <- document
+		}
+	}()
+	return updates
+}
@@ -0,0 +1,569 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// All settings understood by the extension.
+//
+// Every leaf field carries an `env` tag naming the variable it is read from, a `json`
+// tag naming it in the schema, a `desc` tag and optionally `fallback` (another variable
+// consulted when env is unset), `default`, `enum`, `min`, `max`, `sep` (what separates
+// the items of a list, a comma unless set) and `restart` (only applied on a cold start,
+// not on reload). Sections are plain nested structs, `restart` on one covers all of it.
+// Values of the form link:<name> refer to resources linked to the function by SST, other
+// prefixes can be added with RegisterResolver.
+//
+// Settings can also be declared in a JSON or YAML file shaped like the schema, read from
+// /opt/sst-extension.{json,yaml} in the layer and /var/task/sst-extension.{json,yaml} in
+// the function package, or from SST_EXTENSION_CONFIG_FILE. Environment variables take
+// precedence.
+type Config struct {
+	Logs         Logs         `json:"logs"`
+	CloudWatch   CloudWatch   `json:"cloudWatch"`
+	GRPC         GRPC         `json:"grpc"`
+	Quickwit     Quickwit     `json:"quickwit"`
+	VictoriaLogs VictoriaLogs `json:"victoriaLogs"`
+	Vector       Vector       `json:"vector"`
+	S3           S3           `json:"s3"`
+	GCP          GCP          `json:"gcp"`
+	Azure        Azure        `json:"azure"`
+	Sentry       Sentry       `json:"sentry"`
+	XRay         XRay         `json:"xray"`
+	SES          SES          `json:"ses"`
+	PagerDuty    PagerDuty    `json:"pagerDuty"`
+	Summary      Summary      `json:"summary"`
+	Admin        Admin        `json:"admin" restart:"true"`
+	Proxy        Proxy        `json:"proxy" restart:"true"`
+	Retry        Retry        `json:"retry"`
+	Runtime      Runtime      `json:"runtime" restart:"true"`
+	Telemetry    Telemetry    `json:"telemetry" restart:"true"`
+	Flush        Flush        `json:"flush"`
+	Diagnostics  Diagnostics  `json:"diagnostics"`
+	Timeouts     Timeouts     `json:"timeouts"`
+	AppConfig    AppConfig    `json:"appConfig" restart:"true"`
+}
+
+type Logs struct {
+	Quiet          bool     `json:"quiet" env:"SST_EXTENSION_QUIET" restart:"true" desc:"Only write the extension's init line and errors to the function's logs"`
+	Level          string   `json:"level" env:"SST_EXTENSION_LOG_LEVEL" fallback:"AWS_LAMBDA_LOG_LEVEL" enum:",TRACE,DEBUG,INFO,WARN,WARNING,ERROR,FATAL,CRITICAL" desc:"Minimum level of function log lines to forward. Unset forwards everything"`
+	Noise          []string `json:"noise" env:"SST_EXTENSION_LOG_NOISE" enum:"aws-sdk-retry,nextjs-banner,python-warnings,node-warnings" desc:"Comma separated built-in presets of noisy lines to drop: aws-sdk-retry, nextjs-banner, python-warnings, node-warnings"`
+	SampledOnly    bool     `json:"sampledOnly" env:"SST_EXTENSION_LOG_SAMPLED_ONLY" desc:"Forward all function log lines only for X-Ray sampled invocations, keeping just errors for the rest"`
+	SampleRate     float64  `json:"sampleRate" env:"SST_EXTENSION_LOG_SAMPLE_RATE" default:"1" min:"0" max:"1" desc:"Share of successful invocations whose function log lines are forwarded, drawn when each starts, e.g. 0.1. Invocations that fail or time out forward all of them"`
+	Markers        []string `json:"markers" env:"SST_EXTENSION_ACTION_MARKERS" default:"::sst::" desc:"Comma separated prefixes that introduce an in-band action in a function log line. Empty disables actions"`
+	ForwardActions bool     `json:"forwardActions" env:"SST_EXTENSION_FORWARD_ACTIONS" desc:"Forward action lines with their properties redacted instead of dropping them, e.g. for auditing"`
+	Format         string   `json:"format" env:"SST_EXTENSION_LOG_FORMAT" fallback:"AWS_LAMBDA_LOG_FORMAT" default:"Text" enum:"Text,JSON" desc:"Format the runtime writes function logs in, used to detect their level"`
+	DualWrite      bool     `json:"dualWrite" env:"SST_EXTENSION_LOG_DUAL_WRITE" desc:"Also pass function log lines through to the function's own log group while splitting them, e.g. while migrating"`
+	Include        []string `json:"include" env:"SST_EXTENSION_LOG_INCLUDE" sep:"\n" desc:"Regular expressions, one per line, of the function log lines to forward, dropping lines that match none. Unset forwards every line"`
+	Exclude        []string `json:"exclude" env:"SST_EXTENSION_LOG_EXCLUDE" sep:"\n" desc:"Regular expressions, one per line, of function log lines to drop before they are buffered, e.g. health checks"`
+	Redact         []string `json:"redact" env:"SST_EXTENSION_REDACT" enum:"email,credit-card,aws-key,bearer-token" desc:"Comma separated built-in patterns of sensitive values masked before any sink sees a line: email, credit-card, aws-key, bearer-token"`
+	RedactPatterns []string `json:"redactPatterns" env:"SST_EXTENSION_REDACT_PATTERNS" sep:"\n" desc:"Regular expressions, one per line, of further values to mask"`
+	RedactMask     string   `json:"redactMask" env:"SST_EXTENSION_REDACT_MASK" default:"[REDACTED]" desc:"Text replacing redacted values"`
+	Group          string   `json:"group" env:"SST_EXTENSION_DEFAULT_LOG_GROUP" fallback:"AWS_LAMBDA_LOG_GROUP_NAME" desc:"Log group of invocations that never split their logs with log.split, defaults to the function's own group. Group names accept the placeholders {functionName}, {functionVersion}, {date}, {requestId}, {sandbox} and {env:NAME}"`
+}
+
+type CloudWatch struct {
+	AccountTPS         int           `json:"accountTps" env:"SST_EXTENSION_CLOUDWATCH_ACCOUNT_TPS" default:"0" min:"0" desc:"PutLogEvents quota of the account and region, shared out between the function's sandboxes. 0 disables pacing"`
+	Sandboxes          int           `json:"sandboxes" env:"SST_EXTENSION_CLOUDWATCH_SANDBOXES" default:"100" min:"1" desc:"Concurrent sandboxes expected to share the quota, e.g. the function's reserved concurrency"`
+	MaxAttempts        int           `json:"maxAttempts" env:"SST_EXTENSION_CLOUDWATCH_MAX_ATTEMPTS" default:"5" min:"1" desc:"Attempts at each PutLogEvents call on throttling and outages, backing off as configured under retry. Retries stop at the write's deadline"`
+	Stream             string        `json:"stream" env:"SST_EXTENSION_CLOUDWATCH_STREAM" desc:"Log stream to write to, accepting the same placeholders as group names. Defaults to the day the sandbox started followed by its identifier"`
+	RotateBytes        int           `json:"rotateBytes" env:"SST_EXTENSION_CLOUDWATCH_ROTATE_BYTES" default:"0" min:"0" desc:"Bytes written to the sandbox's log stream before moving on to a new one. 0 disables rotating by size"`
+	RotateAge          time.Duration `json:"rotateAge" env:"SST_EXTENSION_CLOUDWATCH_ROTATE_AGE" default:"0s" desc:"Age of the sandbox's log stream before moving on to a new one, e.g. 6h. 0 disables rotating by age"`
+	Region             string        `json:"region" env:"SST_EXTENSION_CLOUDWATCH_REGION" desc:"Region logs are delivered to, defaults to the function's region"`
+	RoleArn            string        `json:"roleArn" env:"SST_EXTENSION_CLOUDWATCH_ROLE_ARN" desc:"IAM role assumed for delivering logs, e.g. one in a central logging account. Unset uses the function's role"`
+	ExternalID         string        `json:"externalId" env:"SST_EXTENSION_CLOUDWATCH_EXTERNAL_ID" desc:"External ID required by the trust policy of the assumed role"`
+	Retention          int           `json:"retention" env:"SST_EXTENSION_CLOUDWATCH_RETENTION" default:"0" min:"0" desc:"Days events are kept in log groups the extension creates, one of the values PutRetentionPolicy accepts. 0 keeps them forever"`
+	Tags               []string      `json:"tags" env:"SST_EXTENSION_CLOUDWATCH_TAGS" desc:"Comma separated key=value tags of log groups the extension creates"`
+	KMSKey             string        `json:"kmsKey" env:"SST_EXTENSION_CLOUDWATCH_KMS_KEY" desc:"ARN of the KMS key log groups the extension creates are encrypted with"`
+	Entity             bool          `json:"entity" env:"SST_EXTENSION_CLOUDWATCH_ENTITY" desc:"Attach an Application Signals service entity to every PutLogEvents call"`
+	Service            string        `json:"service" env:"SST_EXTENSION_CLOUDWATCH_SERVICE" fallback:"AWS_LAMBDA_FUNCTION_NAME" desc:"Service name of the entity and Application Signals metrics, defaults to the function name"`
+	Environment        string        `json:"environment" env:"SST_EXTENSION_CLOUDWATCH_ENVIRONMENT" default:"lambda:default" desc:"Deployment environment of the entity and Application Signals metrics"`
+	ApplicationSignals bool          `json:"applicationSignals" env:"SST_EXTENSION_APPLICATION_SIGNALS" desc:"Emit invocation metrics to the Application Signals log group as EMF and tag spans with its service attributes, replacing the ADOT layer"`
+}
+
+type GRPC struct {
+	Endpoint string `json:"endpoint" env:"SST_EXTENSION_GRPC_ENDPOINT" desc:"Address of a gRPC collector to stream batches to, e.g. collector.internal:4317"`
+	Insecure bool   `json:"insecure" env:"SST_EXTENSION_GRPC_INSECURE" desc:"Disable TLS for collectors reachable inside the VPC only"`
+	Token    string `json:"token" env:"SST_EXTENSION_GRPC_TOKEN" desc:"Bearer token sent in the authorization metadata"`
+	Window   int    `json:"window" env:"SST_EXTENSION_GRPC_WINDOW" default:"16" min:"1" desc:"Maximum number of batches in flight without an acknowledgement"`
+}
+
+type Quickwit struct {
+	Endpoint string `json:"endpoint" env:"SST_EXTENSION_QUICKWIT_ENDPOINT" desc:"Base URL of a Quickwit cluster to ingest into"`
+	Index    string `json:"index" env:"SST_EXTENSION_QUICKWIT_INDEX" desc:"Quickwit index receiving the documents"`
+	Token    string `json:"token" env:"SST_EXTENSION_QUICKWIT_TOKEN" desc:"Bearer token for clusters behind an authenticating proxy"`
+}
+
+type VictoriaLogs struct {
+	Endpoint string `json:"endpoint" env:"SST_EXTENSION_VICTORIALOGS_ENDPOINT" desc:"Base URL of a VictoriaLogs instance to ingest into"`
+	Token    string `json:"token" env:"SST_EXTENSION_VICTORIALOGS_TOKEN" desc:"Bearer token for instances behind an authenticating proxy"`
+}
+
+type Vector struct {
+	Endpoint string `json:"endpoint" env:"SST_EXTENSION_VECTOR_ENDPOINT" desc:"Vector source receiving native JSON events, http(s)://host:port for an http_server source or tcp://host:port for a socket source"`
+	Token    string `json:"token" env:"SST_EXTENSION_VECTOR_TOKEN" desc:"Bearer token for HTTP sources behind an authenticating proxy"`
+}
+
+type S3 struct {
+	Bucket string `json:"bucket" env:"SST_EXTENSION_S3_BUCKET" desc:"Bucket every batch is written to as one object, or link:<name> of a bucket linked by SST. Unset disables the S3 sink"`
+	Prefix string `json:"prefix" env:"SST_EXTENSION_S3_PREFIX" desc:"Prefix prepended to object keys, e.g. logs/"`
+	Format string `json:"format" env:"SST_EXTENSION_S3_FORMAT" default:"json" enum:"json,parquet" desc:"Object format: gzip compressed NDJSON or Parquet with a fixed timestamp, level, requestId, message, attributes schema"`
+}
+
+type GCP struct {
+	Credentials string `json:"credentials" env:"SST_EXTENSION_GCP_CREDENTIALS" desc:"Service account key JSON, or a path to the key file, used to write to Cloud Logging. Unset disables the sink"`
+	ProjectID   string `json:"projectId" env:"SST_EXTENSION_GCP_PROJECT_ID" desc:"Project receiving the entries, defaults to the service account's project"`
+	LogID       string `json:"logId" env:"SST_EXTENSION_GCP_LOG_ID" default:"lambda" desc:"Log name the entries are written under"`
+}
+
+type Azure struct {
+	Endpoint     string `json:"endpoint" env:"SST_EXTENSION_AZURE_ENDPOINT" desc:"Logs ingestion endpoint of the data collection endpoint or rule. Unset disables the sink"`
+	RuleID       string `json:"ruleId" env:"SST_EXTENSION_AZURE_RULE_ID" desc:"Immutable id of the data collection rule"`
+	Stream       string `json:"stream" env:"SST_EXTENSION_AZURE_STREAM" desc:"Stream declared in the data collection rule, e.g. Custom-LambdaLogs_CL"`
+	TenantID     string `json:"tenantId" env:"SST_EXTENSION_AZURE_TENANT_ID" desc:"Entra ID tenant of the application used to authenticate"`
+	ClientID     string `json:"clientId" env:"SST_EXTENSION_AZURE_CLIENT_ID" desc:"Client id of the application used to authenticate"`
+	ClientSecret string `json:"clientSecret" env:"SST_EXTENSION_AZURE_CLIENT_SECRET" desc:"Client secret of the application used to authenticate"`
+}
+
+type Sentry struct {
+	DSN         string `json:"dsn" env:"SST_EXTENSION_SENTRY_DSN" desc:"Project DSN errors are reported to. Unset disables the Sentry sink"`
+	Release     string `json:"release" env:"SST_EXTENSION_SENTRY_RELEASE" fallback:"AWS_LAMBDA_FUNCTION_VERSION" desc:"Release attached to every event"`
+	Environment string `json:"environment" env:"SST_EXTENSION_SENTRY_ENVIRONMENT" fallback:"SST_STAGE" desc:"Environment attached to every event, defaults to the SST stage"`
+}
+
+type XRay struct {
+	Mode          string `json:"mode" env:"SST_EXTENSION_XRAY_MODE" enum:",udp,api" desc:"Submit a subsegment per sampled invocation through the X-Ray daemon (udp) or PutTraceSegments (api). Unset disables it"`
+	DaemonAddress string `json:"daemonAddress" env:"SST_EXTENSION_XRAY_DAEMON_ADDRESS" fallback:"AWS_XRAY_DAEMON_ADDRESS" default:"127.0.0.1:2000" desc:"Address of the X-Ray daemon used in udp mode"`
+}
+
+type SES struct {
+	From        string        `json:"from" env:"SST_EXTENSION_SES_FROM" desc:"Verified SES identity alert digests are sent from"`
+	To          []string      `json:"to" env:"SST_EXTENSION_SES_TO" desc:"Comma separated recipients of alert digests. Unset disables email alerts"`
+	MinInterval time.Duration `json:"minInterval" env:"SST_EXTENSION_SES_MIN_INTERVAL" default:"5m" desc:"Minimum time between two alert emails from the same sandbox"`
+}
+
+type PagerDuty struct {
+	RoutingKey string   `json:"routingKey" env:"SST_EXTENSION_PAGERDUTY_ROUTING_KEY" desc:"Events API v2 integration key. Unset disables PagerDuty alerts"`
+	Reasons    []string `json:"reasons" env:"SST_EXTENSION_PAGERDUTY_REASONS" default:"timeout,oom,crash,error,extension" desc:"Comma separated alert reasons that trigger incidents: timeout, oom, crash, error, extension"`
+}
+
+type Summary struct {
+	Enabled      bool          `json:"enabled" env:"SST_EXTENSION_SUMMARY" desc:"Emit a structured JSON summary record after each invocation's REPORT line"`
+	LogURL       bool          `json:"logUrl" env:"SST_EXTENSION_SUMMARY_LOG_URL" default:"true" desc:"Include a CloudWatch console link to the invocation's logs in the summary"`
+	DedupeWindow time.Duration `json:"dedupeWindow" env:"SST_EXTENSION_SUMMARY_DEDUPE_WINDOW" default:"5m" desc:"Period over which each sink drops repeated REPORT and summary lines for the same invocation, keeping the first. 0s disables it"`
+}
+
+type Admin struct {
+	Address string `json:"address" env:"SST_EXTENSION_ADMIN_ADDRESS" desc:"Address of the local admin endpoint, e.g. 127.0.0.1:9009. Unset disables it"`
+}
+
+type Proxy struct {
+	Address     string `json:"address" env:"SST_EXTENSION_PROXY_ADDRESS" desc:"Address of a Runtime API proxy exposing invocation payloads, e.g. 127.0.0.1:9010. Requires AWS_LAMBDA_EXEC_WRAPPER=/opt/sst-proxy. Unset disables it"`
+	HashPayload bool   `json:"hashPayload" env:"SST_EXTENSION_PROXY_HASH_PAYLOAD" desc:"Include a SHA-256 of each proxied payload in the summary, to find duplicate deliveries"`
+}
+
+type Retry struct {
+	MaxAttempts  int           `json:"maxAttempts" env:"SST_EXTENSION_RETRY_MAX_ATTEMPTS" default:"5" min:"1" desc:"Attempts at registering, subscribing and polling for events before giving up"`
+	InitialDelay time.Duration `json:"initialDelay" env:"SST_EXTENSION_RETRY_INITIAL_DELAY" default:"100ms" desc:"Upper bound of the jittered delay before the first retry, doubled on every attempt"`
+	MaxDelay     time.Duration `json:"maxDelay" env:"SST_EXTENSION_RETRY_MAX_DELAY" default:"2s" desc:"Cap on the delay between two attempts"`
+}
+
+type Runtime struct {
+	MaxIdleConns          int           `json:"maxIdleConns" env:"SST_EXTENSION_RUNTIME_MAX_IDLE_CONNS" default:"4" min:"1" desc:"Idle connections to the Runtime API kept for the extension and telemetry clients"`
+	IdleTimeout           time.Duration `json:"idleTimeout" env:"SST_EXTENSION_RUNTIME_IDLE_TIMEOUT" default:"0s" desc:"How long idle Runtime API connections are kept, 0s keeps them across freezes instead of reconnecting for every poll"`
+	ResponseHeaderTimeout time.Duration `json:"responseHeaderTimeout" env:"SST_EXTENSION_RUNTIME_RESPONSE_HEADER_TIMEOUT" default:"0s" desc:"Limit on waiting for Runtime API response headers. Must stay 0s or above the longest idle period, /event/next only answers when an event arrives"`
+}
+
+type Telemetry struct {
+	MaxItems    int           `json:"maxItems" env:"SST_EXTENSION_TELEMETRY_MAX_ITEMS" default:"1000" min:"1000" max:"10000" desc:"Events the Telemetry API buffers before delivering them"`
+	MaxBytes    int           `json:"maxBytes" env:"SST_EXTENSION_TELEMETRY_MAX_BYTES" default:"262144" min:"262144" max:"1048576" desc:"Bytes the Telemetry API buffers before delivering them"`
+	Types       []string      `json:"types" env:"SST_EXTENSION_TELEMETRY_TYPES" default:"platform,function" enum:"platform,function,extension" desc:"Comma separated telemetry streams to subscribe to. platform is required, add extension to also forward the output of extensions, this one included or see SST_EXTENSION_METRICS_ONLY"`
+	QueueSize   int           `json:"queueSize" env:"SST_EXTENSION_QUEUE_SIZE" default:"1000" min:"1" desc:"Telemetry events buffered between the listener and the pipeline"`
+	QueuePolicy string        `json:"queuePolicy" env:"SST_EXTENSION_QUEUE_POLICY" default:"block" enum:"block,drop-newest,drop-oldest" desc:"What to do when the queue is full: hold up the platform's delivery, or drop the newest or oldest event. Drops are counted in the admin endpoint's /stats"`
+	MetricsOnly bool          `json:"metricsOnly" env:"SST_EXTENSION_METRICS_ONLY" desc:"Only subscribe to platform events whatever the types, so function and extension output never leaves the Telemetry API. REPORT and summary lines are still written"`
+	Protocol    string        `json:"protocol" env:"SST_EXTENSION_TELEMETRY_PROTOCOL" default:"http" enum:"http,tcp" desc:"How the Telemetry API delivers events: an HTTP request per batch, or a stream over a long lived TCP connection with lower latency"`
+	Host        string        `json:"host" env:"SST_EXTENSION_LISTENER_HOST" default:"sandbox" desc:"Hostname the telemetry listener binds to and is subscribed under, e.g. sandbox.localdomain, or 0.0.0.0 for local testing"`
+	Port        int           `json:"port" env:"SST_EXTENSION_LISTENER_PORT" default:"0" min:"0" max:"65535" desc:"Port of the telemetry listener, 0 for 4323 with HTTP and 4324 with TCP. An ephemeral port is used when it is taken"`
+	MaxBody     int           `json:"maxBody" env:"SST_EXTENSION_LISTENER_MAX_BODY" default:"4194304" min:"1048576" desc:"Largest telemetry request body accepted in bytes, after decompressing gzip. Larger ones are refused with 413"`
+	Heartbeat   time.Duration `json:"heartbeat" env:"SST_EXTENSION_TELEMETRY_HEARTBEAT" default:"10s" desc:"Time an invocation may go without any telemetry before the listener is restarted on a new port and resubscribed. Must exceed the buffering timeout, 0s disables it"`
+	Timeout     time.Duration `json:"timeout" env:"SST_EXTENSION_TELEMETRY_TIMEOUT" default:"1s" desc:"Longest time the Telemetry API buffers events, between 25ms and 30s. Lower it to reduce delivery latency"`
+}
+
+type Flush struct {
+	SpillDir       string        `json:"spillDir" env:"SST_EXTENSION_SPILL_DIR" restart:"true" default:"/tmp/sst-extension" desc:"Directory undelivered batches are kept in so they survive an extension restart. Empty keeps them in memory only"`
+	MaxPending     int           `json:"maxPending" env:"SST_EXTENSION_MAX_PENDING" restart:"true" default:"64" min:"0" desc:"Maximum number of undelivered batches kept for retrying, the oldest are dropped beyond it. 0 for unlimited"`
+	Interval       time.Duration `json:"interval" env:"SST_EXTENSION_FLUSH_INTERVAL" default:"5s" desc:"Interval at which the lines of running invocations are flushed, so long invocations show up while they run. 0s flushes on platform.runtimeDone only"`
+	MaxBytes       int           `json:"maxBytes" env:"SST_EXTENSION_FLUSH_MAX_BYTES" default:"262144" min:"0" desc:"Size of an invocation's buffered lines in bytes at which they are flushed before the interval is up. 0 disables it"`
+	MaxMemory      int           `json:"maxMemory" env:"SST_EXTENSION_FLUSH_MAX_MEMORY" default:"33554432" min:"0" desc:"Size in bytes of the lines buffered across invocations beyond which the least important are dropped, debug level first, replaced by a LOGS_SHED notice. 0 disables it"`
+	Queue          int           `json:"queue" env:"SST_EXTENSION_FLUSH_QUEUE" restart:"true" default:"16" min:"1" desc:"Invocations handed off to the background flusher that may wait for delivery before the invoke loop waits for room"`
+	Sync           bool          `json:"sync" env:"SST_EXTENSION_FLUSH_SYNC" desc:"Wait for each invocation's delivery before polling for the next event, at the cost of adding it to the invocation's duration, instead of delivering in the background"`
+	LateWindow     time.Duration `json:"lateWindow" env:"SST_EXTENSION_LATE_LOG_WINDOW" default:"30s" desc:"Time an invocation's buffer is kept after platform.runtimeDone for lines the runtime flushes late, unless its platform.report arrives first"`
+	DeadlineMargin time.Duration `json:"deadlineMargin" env:"SST_EXTENSION_DEADLINE_MARGIN" restart:"true" default:"200ms" desc:"Time before an invocation's deadline at which flushing is abandoned, so the extension never delays the sandbox freeze"`
+}
+
+type Diagnostics struct {
+	Bucket string `json:"bucket" env:"SST_EXTENSION_DIAGNOSTICS_BUCKET" desc:"Bucket a diagnostic bundle with the undelivered batches and recent errors is written to when the shutdown flush fails, or link:<name>. Unset disables it"`
+	Prefix string `json:"prefix" env:"SST_EXTENSION_DIAGNOSTICS_PREFIX" default:"diagnostics/" desc:"Prefix prepended to diagnostic bundle keys"`
+}
+
+// Limits on each stage, so the extension never runs past the platform's lifecycle deadlines.
+// Stages within an invocation are further bounded by its deadline.
+type Timeouts struct {
+	Register  time.Duration `json:"register" env:"SST_EXTENSION_REGISTER_TIMEOUT" restart:"true" default:"5s" desc:"Limit on each attempt to register with the Extensions API"`
+	Subscribe time.Duration `json:"subscribe" env:"SST_EXTENSION_SUBSCRIBE_TIMEOUT" default:"5s" desc:"Limit on each attempt to subscribe to the Telemetry API"`
+	Sink      time.Duration `json:"sink" env:"SST_EXTENSION_SINK_TIMEOUT" default:"10s" desc:"Limit on each write to a sink, so one slow destination can't use up the time of the others"`
+	Alert     time.Duration `json:"alert" env:"SST_EXTENSION_ALERT_TIMEOUT" default:"5s" desc:"Limit on notifying the alerters of one alert, including during shutdown"`
+	LateFlush time.Duration `json:"lateFlush" env:"SST_EXTENSION_LATE_FLUSH_TIMEOUT" default:"1s" desc:"Time for flushing an invocation that only completed after its deadline, e.g. after a timeout"`
+}
+
+// Configuration profile pulled from AWS AppConfig, shaped like the configuration file.
+// Changes apply between invocations, sinks included. A profile changing settings tagged
+// restart is rejected until the next cold start.
+type AppConfig struct {
+	Application string        `json:"application" env:"SST_EXTENSION_APPCONFIG_APPLICATION" desc:"AppConfig application the configuration is pulled from. Unset disables it"`
+	Environment string        `json:"environment" env:"SST_EXTENSION_APPCONFIG_ENVIRONMENT" desc:"AppConfig environment of the application"`
+	Profile     string        `json:"profile" env:"SST_EXTENSION_APPCONFIG_PROFILE" desc:"AppConfig configuration profile holding the settings"`
+	Interval    time.Duration `json:"interval" env:"SST_EXTENSION_APPCONFIG_INTERVAL" default:"60s" desc:"Interval at which AppConfig is polled for changes, at least 15s"`
+}
+
+// Retention periods in days PutRetentionPolicy accepts
+var retentionDays = []int{1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1096, 1827, 2192, 2557, 2922, 3288, 3653}
+
+// Reports whether CloudWatch Logs accepts a retention of the given number of days
+func ValidRetention(days int) bool {
+	return slices.Contains(retentionDays, days)
+}
+
+// Reads the configuration from the environment and the configuration files, applying
+// defaults for unset settings
+func Load() (*Config, error) {
+	return LoadWith(nil)
+}
+
+// Reads the configuration like Load, with a JSON or YAML document shaped like the schema,
+// e.g. pulled from AppConfig, overriding the configuration files. Environment variables
+// still take precedence.
+func LoadWith(overlay []byte) (*Config, error) {
+	files, err := readFiles()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileEnv, err)
+	}
+	if len(overlay) > 0 {
+		var document map[string]interface{}
+		if err := yaml.Unmarshal(overlay, &document); err != nil {
+			return nil, fmt.Errorf("invalid configuration document: %w", err)
+		}
+		if err := flatten(reflect.TypeOf(Config{}), document, "", files); err != nil {
+			return nil, fmt.Errorf("invalid configuration document: %w", err)
+		}
+	}
+	cfg := &Config{}
+	var errs []error
+	walk(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, value reflect.Value) {
+		raw, ok := os.LookupEnv(field.Tag.Get("env"))
+		if !ok {
+			raw, ok = files[field.Tag.Get("env")]
+		}
+		if fallback := field.Tag.Get("fallback"); !ok && fallback != "" {
+			raw, ok = os.LookupEnv(fallback)
+		}
+		if !ok {
+			raw, ok = field.Tag.Lookup("default")
+		}
+		if !ok {
+			return
+		}
+		raw, err := resolveLinks(raw, value.Kind() == reflect.Slice, separator(field))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field.Tag.Get("env"), err))
+			return
+		}
+		if err := set(value, raw, separator(field)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field.Tag.Get("env"), err))
+		}
+		normalize(field, value)
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Returns the variables of the settings tagged restart that differ between the running
+// configuration and a reloaded one, which a reload can't apply
+func RestartRequired(current *Config, next *Config) []string {
+	var changed []string
+	var visit func(a reflect.Value, b reflect.Value, restart bool)
+	visit = func(a reflect.Value, b reflect.Value, restart bool) {
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			fixed := restart || field.Tag.Get("restart") == "true"
+			if _, ok := field.Tag.Lookup("env"); !ok && field.Type.Kind() == reflect.Struct {
+				visit(a.Field(i), b.Field(i), fixed)
+				continue
+			}
+			if fixed && !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+				changed = append(changed, field.Tag.Get("env"))
+			}
+		}
+	}
+	visit(reflect.ValueOf(current).Elem(), reflect.ValueOf(next).Elem(), false)
+	return changed
+}
+
+// Prefix of the variables the extension is configured with
+const envPrefix = "SST_EXTENSION_"
+
+// Returns the SST_EXTENSION_ variables set in the environment that no setting reads,
+// usually misspelled names whose setting silently keeps its default
+func Unknown() []string {
+	known := map[string]bool{fileEnv: true}
+	walk(reflect.ValueOf(&Config{}).Elem(), func(field reflect.StructField, value reflect.Value) {
+		known[field.Tag.Get("env")] = true
+	})
+	unknown := []string{}
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		if strings.HasPrefix(name, envPrefix) && !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	slices.Sort(unknown)
+	return unknown
+}
+
+// Checks constraints on the loaded values
+func (c *Config) Validate() error {
+	var errs []error
+	walk(reflect.ValueOf(c).Elem(), func(field reflect.StructField, value reflect.Value) {
+		if err := check(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field.Tag.Get("env"), err))
+		}
+	})
+	if c.Telemetry.Timeout < 25*time.Millisecond || c.Telemetry.Timeout > 30*time.Second {
+		errs = append(errs, fmt.Errorf("SST_EXTENSION_TELEMETRY_TIMEOUT: must be between 25ms and 30s, got %s", c.Telemetry.Timeout))
+	}
+	if c.Telemetry.Heartbeat > 0 && c.Telemetry.Heartbeat <= c.Telemetry.Timeout {
+		errs = append(errs, fmt.Errorf("SST_EXTENSION_TELEMETRY_HEARTBEAT: must exceed SST_EXTENSION_TELEMETRY_TIMEOUT, got %s", c.Telemetry.Heartbeat))
+	}
+	platform := false
+	for _, kind := range c.Telemetry.Types {
+		platform = platform || kind == "platform"
+	}
+	if !platform {
+		errs = append(errs, errors.New("SST_EXTENSION_TELEMETRY_TYPES: must include platform, invocations are delimited by its events"))
+	}
+	if c.Quickwit.Endpoint != "" && c.Quickwit.Index == "" {
+		errs = append(errs, errors.New("SST_EXTENSION_QUICKWIT_INDEX: required when SST_EXTENSION_QUICKWIT_ENDPOINT is set"))
+	}
+	if c.Azure.Endpoint != "" {
+		required := []struct{ env, value string }{
+			{"SST_EXTENSION_AZURE_RULE_ID", c.Azure.RuleID},
+			{"SST_EXTENSION_AZURE_STREAM", c.Azure.Stream},
+			{"SST_EXTENSION_AZURE_TENANT_ID", c.Azure.TenantID},
+			{"SST_EXTENSION_AZURE_CLIENT_ID", c.Azure.ClientID},
+			{"SST_EXTENSION_AZURE_CLIENT_SECRET", c.Azure.ClientSecret},
+		}
+		for _, setting := range required {
+			if setting.value == "" {
+				errs = append(errs, fmt.Errorf("%s: required when SST_EXTENSION_AZURE_ENDPOINT is set", setting.env))
+			}
+		}
+	}
+	for _, reason := range c.PagerDuty.Reasons {
+		switch reason {
+		case "timeout", "oom", "crash", "error", "extension":
+		default:
+			errs = append(errs, fmt.Errorf("SST_EXTENSION_PAGERDUTY_REASONS: unknown reason %q", reason))
+		}
+	}
+	if c.CloudWatch.Retention > 0 && !ValidRetention(c.CloudWatch.Retention) {
+		errs = append(errs, fmt.Errorf("SST_EXTENSION_CLOUDWATCH_RETENTION: not a retention CloudWatch Logs accepts, got %d", c.CloudWatch.Retention))
+	}
+	for _, tag := range c.CloudWatch.Tags {
+		if key, _, ok := strings.Cut(tag, "="); !ok || key == "" {
+			errs = append(errs, fmt.Errorf("SST_EXTENSION_CLOUDWATCH_TAGS: expected key=value, got %q", tag))
+		}
+	}
+	for _, patterns := range []struct {
+		env   string
+		value []string
+	}{{"SST_EXTENSION_LOG_INCLUDE", c.Logs.Include}, {"SST_EXTENSION_LOG_EXCLUDE", c.Logs.Exclude}, {"SST_EXTENSION_REDACT_PATTERNS", c.Logs.RedactPatterns}} {
+		for _, pattern := range patterns.value {
+			if _, err := regexp.Compile(pattern); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", patterns.env, err))
+			}
+		}
+	}
+	if c.AppConfig.Application != "" {
+		if c.AppConfig.Environment == "" || c.AppConfig.Profile == "" {
+			errs = append(errs, errors.New("SST_EXTENSION_APPCONFIG_ENVIRONMENT, SST_EXTENSION_APPCONFIG_PROFILE: required when SST_EXTENSION_APPCONFIG_APPLICATION is set"))
+		}
+		if c.AppConfig.Interval < 15*time.Second {
+			errs = append(errs, fmt.Errorf("SST_EXTENSION_APPCONFIG_INTERVAL: must be at least 15s, got %s", c.AppConfig.Interval))
+		}
+	}
+	if len(c.SES.To) > 0 && c.SES.From == "" {
+		errs = append(errs, errors.New("SST_EXTENSION_SES_FROM: required when SST_EXTENSION_SES_TO is set"))
+	}
+	return errors.Join(errs...)
+}
+
+// Calls fn for every leaf setting, descending into sections
+func walk(v reflect.Value, fn func(field reflect.StructField, value reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := field.Tag.Lookup("env"); !ok && field.Type.Kind() == reflect.Struct {
+			walk(v.Field(i), fn)
+			continue
+		}
+		fn(field, v.Field(i))
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Returns what separates the items of a list setting
+func separator(field reflect.StructField) string {
+	if sep, ok := field.Tag.Lookup("sep"); ok {
+		return sep
+	}
+	return ","
+}
+
+func set(value reflect.Value, raw string, sep string) error {
+	if value.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		value.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		value.SetFloat(f)
+	case reflect.Slice:
+		items := []string{}
+		for _, item := range strings.Split(raw, sep) {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", value.Type())
+	}
+	return nil
+}
+
+// Spells values of an enum setting the way the enum does, so debug loads as DEBUG.
+// Values matching no option are left for check to reject.
+func normalize(field reflect.StructField, value reflect.Value) {
+	enum, ok := field.Tag.Lookup("enum")
+	if !ok {
+		return
+	}
+	options := strings.Split(enum, ",")
+	canonical := func(value string) string {
+		for _, option := range options {
+			if strings.EqualFold(value, option) {
+				return option
+			}
+		}
+		return value
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(canonical(value.String()))
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			value.Index(i).SetString(canonical(value.Index(i).String()))
+		}
+	}
+}
+
+func check(field reflect.StructField, value reflect.Value) error {
+	if min, ok := field.Tag.Lookup("min"); ok {
+		n, _ := strconv.ParseFloat(min, 64)
+		var actual float64
+		switch value.Kind() {
+		case reflect.Int, reflect.Int64:
+			actual = float64(value.Int())
+		case reflect.Float64:
+			actual = value.Float()
+		}
+		if actual < n {
+			return fmt.Errorf("must be at least %s", min)
+		}
+	}
+	if max, ok := field.Tag.Lookup("max"); ok {
+		n, _ := strconv.ParseFloat(max, 64)
+		var actual float64
+		switch value.Kind() {
+		case reflect.Int, reflect.Int64:
+			actual = float64(value.Int())
+		case reflect.Float64:
+			actual = value.Float()
+		}
+		if actual > n {
+			return fmt.Errorf("must be at most %s", max)
+		}
+	}
+	if enum, ok := field.Tag.Lookup("enum"); ok {
+		options := strings.Split(enum, ",")
+		switch value.Kind() {
+		case reflect.String:
+			return oneOf(options, value.String())
+		case reflect.Slice:
+			for _, item := range value.Interface().([]string) {
+				if err := oneOf(options, item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func oneOf(options []string, value string) error {
+	for _, option := range options {
+		if value == option {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s, got %q", strings.Join(options, ","), value)
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+// Clears a variable for the duration of the test
+func unsetenv(t *testing.T, name string) {
+	t.Setenv(name, "")
+	os.Unsetenv(name)
+}
+
+func TestLevelFromFallbackIgnoresCase(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want string
+	}{
+		{"debug", "DEBUG"},
+		{"Info", "INFO"},
+		{"WARNING", "WARNING"},
+		{"warn", "WARN"},
+		{"critical", "CRITICAL"},
+	}
+	unsetenv(t, "SST_EXTENSION_LOG_LEVEL")
+	for _, c := range cases {
+		t.Run(c.raw, func(t *testing.T) {
+			t.Setenv("AWS_LAMBDA_LOG_LEVEL", c.raw)
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Logs.Level != c.want {
+				t.Errorf("Logs.Level = %q, want %q", cfg.Logs.Level, c.want)
+			}
+		})
+	}
+}
+
+func TestEnumIgnoresCase(t *testing.T) {
+	t.Setenv("SST_EXTENSION_LOG_FORMAT", "json")
+	t.Setenv("SST_EXTENSION_TELEMETRY_TYPES", "Platform,FUNCTION")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Logs.Format != "JSON" {
+		t.Errorf("Logs.Format = %q, want JSON", cfg.Logs.Format)
+	}
+	if len(cfg.Telemetry.Types) != 2 || cfg.Telemetry.Types[0] != "platform" || cfg.Telemetry.Types[1] != "function" {
+		t.Errorf("Telemetry.Types = %q, want platform and function", cfg.Telemetry.Types)
+	}
+}
+
+func TestEnumRejectsUnknownValues(t *testing.T) {
+	unsetenv(t, "SST_EXTENSION_LOG_LEVEL")
+	t.Setenv("AWS_LAMBDA_LOG_LEVEL", "verbose")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
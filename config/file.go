@@ -0,0 +1,125 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Variable naming the configuration file, replacing the default locations
+const fileEnv = "SST_EXTENSION_CONFIG_FILE"
+
+// Configuration files read when SST_EXTENSION_CONFIG_FILE is unset, the function
+// package's overriding the layer's
+var defaultFiles = []string{
+	"/opt/sst-extension.json",
+	"/opt/sst-extension.yaml",
+	"/var/task/sst-extension.json",
+	"/var/task/sst-extension.yaml",
+}
+
+// Reads the configuration files, JSON or YAML keyed the same way as the schema, into the
+// raw values of the settings they set by variable name. Environment variables override them.
+func readFiles() (map[string]string, error) {
+	paths := defaultFiles
+	explicit := false
+	if path, ok := os.LookupEnv(fileEnv); ok {
+		paths, explicit = []string{path}, true
+	}
+	values := map[string]string{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) && !explicit {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var document map[string]interface{}
+		if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") {
+			err = yaml.Unmarshal(data, &document)
+		} else {
+			err = json.Unmarshal(data, &document)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := flatten(reflect.TypeOf(Config{}), document, "", values); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return values, nil
+}
+
+// Records the values of a section of the file under the variable names of their settings
+func flatten(t reflect.Type, document map[string]interface{}, path string, values map[string]string) error {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fields[strings.Split(field.Tag.Get("json"), ",")[0]] = field
+	}
+	keys := make([]string, 0, len(document))
+	for key := range document {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var errs []error
+	for _, key := range keys {
+		value := document[key]
+		field, ok := fields[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown setting %s%s", path, key))
+			continue
+		}
+		if _, ok := field.Tag.Lookup("env"); !ok && field.Type.Kind() == reflect.Struct {
+			section, ok := value.(map[string]interface{})
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s%s: expected an object", path, key))
+				continue
+			}
+			if err := flatten(field.Type, section, path+key+".", values); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		raw, err := fileValue(value, separator(field))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s%s: %w", path, key, err))
+			continue
+		}
+		values[field.Tag.Get("env")] = raw
+	}
+	return errors.Join(errs...)
+}
+
+// Formats a value of the file the way its variable would be written
+func fileValue(value interface{}, sep string) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case int:
+		return strconv.Itoa(value), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return "", errors.New("expected a list of strings")
+			}
+			items[i] = s
+		}
+		return strings.Join(items, sep), nil
+	}
+	return "", errors.New("expected a string, number, boolean or list of strings")
+}
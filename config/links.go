@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Prefix of setting values that refer to a resource linked to the function by SST
+const linkPrefix = "link:"
+
+// Property used when a reference doesn't name one, by SST component type
+var linkProperties = map[string]string{
+	"sst.aws.Bucket":   "name",
+	"sst.aws.Queue":    "url",
+	"sst.aws.SnsTopic": "arn",
+	"sst.aws.Email":    "sender",
+	"sst.aws.Dynamo":   "name",
+}
+
+// Resolves "link:MyBucket" or "link:MyBucket.name" against the SST_RESOURCE_<name>
+// variables SST sets for linked resources, so settings stay the same across stages.
+// Other values are returned unchanged. Lists resolve every item.
+func resolveLinks(raw string, list bool, sep string) (string, error) {
+	if !list {
+		return resolveLink(raw)
+	}
+	items := strings.Split(raw, sep)
+	for i, item := range items {
+		resolved, err := resolveLink(strings.TrimSpace(item))
+		if err != nil {
+			return "", err
+		}
+		items[i] = resolved
+	}
+	return strings.Join(items, sep), nil
+}
+
+// Resolves the reference following a registered prefix to the value it stands for
+type Resolver func(reference string) (string, error)
+
+var resolvers = map[string]Resolver{}
+
+// Makes values of the form <prefix><reference> resolve through resolve, e.g. references
+// to secrets kept outside the environment. Call it before Load.
+func RegisterResolver(prefix string, resolve Resolver) {
+	resolvers[prefix] = resolve
+}
+
+func resolveLink(value string) (string, error) {
+	for prefix, resolve := range resolvers {
+		if reference, ok := strings.CutPrefix(value, prefix); ok {
+			return resolve(reference)
+		}
+	}
+	if !strings.HasPrefix(value, linkPrefix) {
+		return value, nil
+	}
+	name, property, _ := strings.Cut(strings.TrimPrefix(value, linkPrefix), ".")
+	raw, ok := os.LookupEnv("SST_RESOURCE_" + name)
+	if !ok {
+		return "", fmt.Errorf("%s is not linked to the function", name)
+	}
+	resource := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(raw), &resource); err != nil {
+		return "", fmt.Errorf("invalid SST_RESOURCE_%s: %w", name, err)
+	}
+	if property == "" {
+		componentType, _ := resource["type"].(string)
+		property = linkProperties[componentType]
+	}
+	candidates := []string{property}
+	if property == "" {
+		candidates = []string{"name", "url", "arn"}
+	}
+	for _, candidate := range candidates {
+		if resolved, ok := resource[candidate].(string); ok && resolved != "" {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("linked resource %s has no %s property", name, strings.Join(candidates, ", "))
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+type schemaNode struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Type                 string                 `json:"type"`
+	Description          string                 `json:"description,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	Items                *schemaNode            `json:"items,omitempty"`
+	Properties           map[string]*schemaNode `json:"properties,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Env                  string                 `json:"x-env,omitempty"`
+	EnvFallback          string                 `json:"x-env-fallback,omitempty"`
+}
+
+// Generates a JSON Schema describing every setting, keyed the same way as the `json` tags.
+// The environment variable for each setting is recorded under x-env, and the variable
+// it falls back to under x-env-fallback.
+func Schema() ([]byte, error) {
+	root := section(reflect.TypeOf(Config{}))
+	root.Schema = schemaDraft
+	root.Title = "SST extension configuration"
+	return json.MarshalIndent(root, "", "  ")
+}
+
+func section(t reflect.Type) *schemaNode {
+	closed := false
+	node := &schemaNode{
+		Type:                 "object",
+		Properties:           map[string]*schemaNode{},
+		AdditionalProperties: &closed,
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if _, ok := field.Tag.Lookup("env"); !ok && field.Type.Kind() == reflect.Struct {
+			node.Properties[name] = section(field.Type)
+			continue
+		}
+		node.Properties[name] = leaf(field)
+	}
+	return node
+}
+
+func leaf(field reflect.StructField) *schemaNode {
+	node := &schemaNode{
+		Type:        schemaType(field.Type),
+		Description: field.Tag.Get("desc"),
+		Env:         field.Tag.Get("env"),
+		EnvFallback: field.Tag.Get("fallback"),
+	}
+	var enum []string
+	if options, ok := field.Tag.Lookup("enum"); ok {
+		enum = strings.Split(options, ",")
+	}
+	if field.Type.Kind() == reflect.Slice {
+		node.Items = &schemaNode{Type: "string", Enum: enum}
+	} else {
+		node.Enum = enum
+	}
+	if min, ok := field.Tag.Lookup("min"); ok {
+		n, _ := strconv.ParseFloat(min, 64)
+		node.Minimum = &n
+	}
+	if max, ok := field.Tag.Lookup("max"); ok {
+		n, _ := strconv.ParseFloat(max, 64)
+		node.Maximum = &n
+	}
+	if def, ok := field.Tag.Lookup("default"); ok {
+		value := reflect.New(field.Type).Elem()
+		if err := set(value, def, separator(field)); err == nil && field.Type != durationType {
+			node.Default = value.Interface()
+		} else {
+			node.Default = def
+		}
+	}
+	return node
+}
+
+func schemaType(t reflect.Type) string {
+	if t == durationType {
+		// Go duration strings such as 500ms or 2s
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int64:
+		return "integer"
+	case reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		return "array"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/sst/extension/config"
+	"github.com/sst/extension/wal"
+)
+
+// Error lines of the extension kept for the diagnostic bundle
+const diagnosticLines = 100
+
+// Passes the extension's log output through, remembering the latest error lines
+type errorLog struct {
+	out   io.Writer
+	mu    sync.Mutex
+	lines []string
+}
+
+func (w *errorLog) Write(p []byte) (int, error) {
+	if quietPattern.Match(p) {
+		w.mu.Lock()
+		w.lines = append(w.lines, string(bytes.TrimRight(p, "\n")))
+		if len(w.lines) > diagnosticLines {
+			w.lines = w.lines[len(w.lines)-diagnosticLines:]
+		}
+		w.mu.Unlock()
+	}
+	return w.out.Write(p)
+}
+
+func (w *errorLog) Lines() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string{}, w.lines...)
+}
+
+// What is left of a sandbox whose logs could not be delivered
+type diagnosticBundle struct {
+	Type        string       `json:"type"`
+	Time        time.Time    `json:"time"`
+	ExtensionID string       `json:"extensionId"`
+	Function    string       `json:"function"`
+	Version     string       `json:"version"`
+	ConfigHash  string       `json:"configHash"`
+	Failure     string       `json:"failure"`
+	Errors      []string     `json:"errors"`
+	Pending     []wal.Record `json:"pending"`
+}
+
+// Identifies the configuration without revealing it, settings include credentials
+func configHash(settings *config.Config) string {
+	data, _ := json.Marshal(settings)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Writes the bundle as a gzip compressed JSON object. It is the last resort after the
+// sinks failed, so the caller only logs the outcome.
+func writeDiagnostics(ctx context.Context, client *s3.Client, settings *config.Config, bundle *diagnosticBundle) error {
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	if err := json.NewEncoder(writer).Encode(bundle); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s%s/%s/%s.json.gz",
+		settings.Diagnostics.Prefix, os.Getenv("AWS_LAMBDA_FUNCTION_NAME"), bundle.Time.Format("2006/01/02"), bundle.ExtensionID)
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:          aws.String(settings.Diagnostics.Bucket),
+		Key:             aws.String(key),
+		Body:            bytes.NewReader(body.Bytes()),
+		ContentType:     aws.String("application/json"),
+		ContentEncoding: aws.String("gzip"),
+	})
+	return err
+}
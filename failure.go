@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/sst/extension/api/extension"
+)
+
+// Error types reported to the platform when the extension gives up
+const (
+	errorConfig    = "Extension.ConfigError"
+	errorRegister  = "Extension.RegisterFailure"
+	errorListener  = "Extension.ListenerFailure"
+	errorSubscribe = "Extension.SubscribeFailure"
+	errorSink      = "Extension.SinkFailure"
+	errorEvent     = "Extension.EventFailure"
+	errorPanic     = "Extension.Panic"
+)
+
+// A fatal error classified for /init/error or /exit/error
+type failure struct {
+	errorType string
+	err       error
+}
+
+func (f *failure) Error() string {
+	return fmt.Sprintf("%s: %v", f.errorType, f.err)
+}
+
+// Aborts the extension, the error is reported by recoverFailure
+func fail(errorType string, err error) {
+	panic(&failure{errorType: errorType, err: err})
+}
+
+// Deferred in main: turns a panic into an /init/error or /exit/error report, depending on
+// whether the first event was received, and exits. Unclassified panics are Extension.Panic.
+func recoverFailure(client **extension.Client, initialized *bool) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	f, ok := recovered.(*failure)
+	if !ok {
+		f = &failure{errorType: errorPanic, err: fmt.Errorf("%v", recovered)}
+	}
+	log.Println("[main:recoverFailure] Exiting.", f)
+	if *client != nil && (*client).ExtensionID() != "" {
+		report := &extension.ErrorRequest{
+			ErrorMessage: f.err.Error(),
+			ErrorType:    f.errorType,
+			StackTrace:   strings.Split(strings.TrimSpace(string(debug.Stack())), "\n"),
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		var err error
+		if *initialized {
+			_, err = (*client).ExitError(ctx, f.errorType, report)
+		} else {
+			_, err = (*client).InitError(ctx, f.errorType, report)
+		}
+		if err != nil {
+			log.Println("[main:recoverFailure] Failed to report error:", err)
+		}
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// Runs deliveries in a background worker, so the invoke loop hands off an invocation's
+// batch and returns to EventNext without waiting for the sinks. Batches are in the
+// write-ahead log before they are handed off, a sandbox frozen mid-delivery retries them
+// on the next flush.
+type flusher struct {
+	jobs chan flushJob
+	mu   sync.Mutex
+	// Jobs queued or running
+	pending int
+	// Closed whenever pending drops to zero
+	idle chan struct{}
+	// Cancels the job running, nil between jobs
+	cancel context.CancelFunc
+	// Set by Stop, jobs submitted afterwards are refused
+	stopped bool
+	stop    chan struct{}
+	// Closed once the worker returned
+	exited chan struct{}
+}
+
+// A job with the context it was submitted with
+type flushJob struct {
+	ctx context.Context
+	run func(ctx context.Context)
+}
+
+// Starts the worker, it stops once ctx is done or Stop is called
+func newFlusher(ctx context.Context, size int) *flusher {
+	f := &flusher{
+		jobs:   make(chan flushJob, size),
+		idle:   make(chan struct{}),
+		stop:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	close(f.idle)
+	go func() {
+		defer close(f.exited)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-f.stop:
+				return
+			case job := <-f.jobs:
+				f.run(ctx, job)
+			}
+		}
+	}()
+	return f
+}
+
+// Runs a job with the context it was submitted with, cut short when the worker's ctx
+// is done or Stop is called
+func (f *flusher) run(ctx context.Context, job flushJob) {
+	defer f.done()
+	jobCtx, cancel := context.WithCancel(job.ctx)
+	defer cancel()
+	unlink := context.AfterFunc(ctx, cancel)
+	defer unlink()
+	f.mu.Lock()
+	if f.stopped {
+		f.mu.Unlock()
+		return
+	}
+	f.cancel = cancel
+	f.mu.Unlock()
+	job.run(jobCtx)
+	f.mu.Lock()
+	f.cancel = nil
+	f.mu.Unlock()
+}
+
+// Queues a job that runs with ctx, waiting for room while the queue is full unless ctx
+// is done first. Reports whether the job was queued, jobs are refused once Stop was called.
+func (f *flusher) Submit(ctx context.Context, job func(ctx context.Context)) bool {
+	f.mu.Lock()
+	if f.stopped {
+		f.mu.Unlock()
+		return false
+	}
+	if f.pending == 0 {
+		f.idle = make(chan struct{})
+	}
+	f.pending++
+	f.mu.Unlock()
+	select {
+	case f.jobs <- flushJob{ctx: ctx, run: job}:
+		return true
+	case <-ctx.Done():
+		f.done()
+		return false
+	}
+}
+
+func (f *flusher) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pending--; f.pending == 0 {
+		close(f.idle)
+	}
+}
+
+// Waits until every job queued so far ran, or ctx is done. Reports whether they did.
+func (f *flusher) Wait(ctx context.Context) bool {
+	f.mu.Lock()
+	idle := f.idle
+	f.mu.Unlock()
+	select {
+	case <-idle:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Cancels the job running and stops the worker, leaving queued jobs unrun. Their batches
+// stay in the write-ahead log. Reports whether the worker returned before ctx was done,
+// only then is nothing writing to the sinks anymore.
+func (f *flusher) Stop(ctx context.Context) bool {
+	f.mu.Lock()
+	if !f.stopped {
+		f.stopped = true
+		close(f.stop)
+		if f.cancel != nil {
+			f.cancel()
+		}
+	}
+	f.mu.Unlock()
+	select {
+	case <-f.exited:
+		return true
+	case <-ctx.Done():
+		// Unless it returned just as ctx ran out
+		select {
+		case <-f.exited:
+			return true
+		default:
+			return false
+		}
+	}
+}
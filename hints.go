@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/smithy-go"
+)
+
+// A known failure signature with what fixes it
+type remediation struct {
+	// Sink type the signature applies to, empty for any
+	sink string
+	code string
+	// Matched against the error message when set
+	contains string
+	// IAM action or quota involved
+	cause string
+	hint  string
+}
+
+// Checked in order, the first match wins
+var remediations = []remediation{
+	{
+		code:     "AccessDeniedException",
+		contains: "kms",
+		cause:    "kms:GenerateDataKey, kms:Decrypt",
+		hint:     "The log group is encrypted with a KMS key whose policy doesn't allow the function's role. Grant the role these actions on the key.",
+	},
+	{
+		code:  "KMSInvalidStateException",
+		cause: "kms key state",
+		hint:  "The KMS key encrypting the destination is disabled or pending deletion. Re-enable the key or remove it from the log group.",
+	},
+	{
+		sink:  "cloudwatch",
+		code:  "AccessDeniedException",
+		cause: "logs:PutLogEvents, logs:CreateLogGroup, logs:CreateLogStream",
+		hint:  "Grant the function's role these actions on the destination log group and its streams.",
+	},
+	{
+		sink:  "cloudwatch",
+		code:  "ThrottlingException",
+		cause: "PutLogEvents requests per second per account and region",
+		hint:  "Request a quota increase, or set SST_EXTENSION_CLOUDWATCH_ACCOUNT_TPS so sandboxes pace their writes.",
+	},
+	{
+		sink:  "s3",
+		code:  "AccessDenied",
+		cause: "s3:PutObject",
+		hint:  "Grant the function's role s3:PutObject on the bucket and prefix, and kms:GenerateDataKey if it uses SSE-KMS.",
+	},
+	{
+		sink:  "s3",
+		code:  "SlowDown",
+		cause: "S3 requests per second per prefix",
+		hint:  "Spread objects over more prefixes with SST_EXTENSION_S3_PREFIX or batch fewer, larger writes.",
+	},
+}
+
+// Writes a structured remediation record the first time each known failure is seen
+type hinter struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newHinter() *hinter {
+	return &hinter{seen: map[string]bool{}}
+}
+
+// Reports the remediation for a sink's error, if the error is a known signature.
+// consumer is the sink's write-ahead log name, e.g. cloudwatch or s3#2.
+func (h *hinter) Report(consumer string, err error) {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return
+	}
+	sinkType, _, _ := strings.Cut(consumer, "#")
+	for _, r := range remediations {
+		if r.code != apiErr.ErrorCode() || (r.sink != "" && r.sink != sinkType) {
+			continue
+		}
+		if r.contains != "" && !strings.Contains(strings.ToLower(apiErr.ErrorMessage()), r.contains) {
+			continue
+		}
+		key := consumer + "/" + r.code + "/" + r.cause
+		h.mu.Lock()
+		seen := h.seen[key]
+		h.seen[key] = true
+		h.mu.Unlock()
+		if seen {
+			return
+		}
+		line, _ := json.Marshal(map[string]string{
+			"type":  "sst.extension.hint",
+			"sink":  consumer,
+			"code":  apiErr.ErrorCode(),
+			"cause": r.cause,
+			"hint":  r.hint,
+		})
+		// Straight to stderr like the init line, quiet mode must not hide it
+		fmt.Fprintln(os.Stderr, string(line))
+		return
+	}
+}
@@ -6,33 +6,131 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math/rand"
+	"net/http"
 	"os"
 	"os/signal"
-	"regexp"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
-	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
-	"github.com/aws/smithy-go"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
+	"github.com/sst/extension/admin"
 	"github.com/sst/extension/api/extension"
+	"github.com/sst/extension/api/retry"
 	"github.com/sst/extension/api/telemetry"
+	"github.com/sst/extension/api/transport"
+	"github.com/sst/extension/config"
+	"github.com/sst/extension/pipeline"
+	"github.com/sst/extension/processor"
+	"github.com/sst/extension/proxy"
 	"github.com/sst/extension/server"
+	"github.com/sst/extension/sink"
+	"github.com/sst/extension/summary"
+	"github.com/sst/extension/wal"
 )
 
-type Action struct {
-	Action     string          `json:"action"`
-	Properties json.RawMessage `json:"properties"`
+// Number of trailing log lines included in alerts
+const alertLines = 50
+
+// Time left for flushing sinks before the shutdown deadline
+const shutdownMargin = 500 * time.Millisecond
+
+// Longest the platform's shutdown phase gives an extension, used when signalled without
+// a shutdown event and its deadline
+const shutdownWindow = 2 * time.Second
+
+// Added to the buffering timeout when waiting for the platform to finish delivering
+const drainSlack = 100 * time.Millisecond
+
+// Alert raised for the outcome of an invocation, if it failed fatally
+func runtimeDoneReason(done server.PlatformRuntimeDone) (sink.AlertReason, bool) {
+	switch {
+	case done.Status == "timeout":
+		return sink.AlertTimeout, true
+	case done.ErrorType == "Runtime.OutOfMemory":
+		return sink.AlertOutOfMemory, true
+	case done.Status == "failure":
+		return sink.AlertCrash, true
+	}
+	return "", false
 }
 
-type LogSplitAction struct {
-	LogGroupName string `json:"logGroupName"`
+// Returns the runtimeDone that completes an invocation, for a runtimeDone or a Logs API
+// platform.end. The 2021-03-18 schema sends both for the same invocation, so whichever
+// comes second reports false and is dropped, as is a platform.end of an invocation that
+// isn't known. The end has no outcome, it counts as a success unless a fault was seen.
+func completion(correlator *pipeline.Correlator, evt server.Event) (server.PlatformRuntimeDone, bool) {
+	switch v := evt.Record.(type) {
+	case server.PlatformRuntimeDone:
+		if state, ok := correlator.Lookup(v.RequestID); ok && !state.Done.IsZero() {
+			return server.PlatformRuntimeDone{}, false
+		}
+		return v, true
+	case server.PlatformEndEvent:
+		state, ok := correlator.Lookup(v.RequestID)
+		if !ok || !state.Done.IsZero() {
+			return server.PlatformRuntimeDone{}, false
+		}
+		done := server.PlatformRuntimeDone{RequestID: v.RequestID, Status: "success"}
+		if state.Faulted {
+			done.Status = "failure"
+		}
+		if !state.Started.IsZero() {
+			done.Metrics.DurationMs = float64(evt.Time.Sub(state.Started)) / float64(time.Millisecond)
+		}
+		return done, true
+	}
+	return server.PlatformRuntimeDone{}, false
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		command(os.Args[1])
+		return
+	}
+
+	var extensionClient *extension.Client
+	initialized := false
+	defer recoverFailure(&extensionClient, &initialized)
+
+	settings, err := config.Load()
+	if err != nil {
+		fail(errorConfig, err)
+	}
+	errorLines := &errorLog{out: os.Stderr}
+	if settings.Logs.Quiet {
+		errorLines.out = quietWriter{out: os.Stderr}
+	}
+	log.SetOutput(errorLines)
+	for _, name := range config.Unknown() {
+		log.Println("[main:config] Ignoring unknown setting", name)
+	}
+	// The AppConfig profile is pulled before anything is built from the settings, and watched
+	// for changes applied between invocations
+	var appConfig *appConfigPoller
+	// Latest AppConfig profile, kept for reloads
+	var appConfigDocument []byte
+	if settings.AppConfig.Application != "" {
+		awsCfg, _ := awsconfig.LoadDefaultConfig(context.Background())
+		appConfig = newAppConfigPoller(awsCfg, settings.AppConfig)
+		pollCtx, cancelPoll := context.WithTimeout(context.Background(), secretTimeout)
+		document, err := appConfig.Poll(pollCtx)
+		cancelPoll()
+		if err != nil {
+			log.Println("[main:appconfig] Failed to pull AppConfig, starting without it:", err)
+		} else if document != nil {
+			if next, err := config.LoadWith(document); err != nil {
+				log.Println("[main:appconfig] Ignoring invalid AppConfig profile:", err)
+			} else {
+				settings, appConfigDocument = next, document
+			}
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
@@ -40,128 +138,1157 @@ func main() {
 		<-sigs
 		cancel()
 	}()
+	// SIGHUP re-reads the configuration when run locally, before the next invocation
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
 
-	extensionId, err := extension.Register(ctx)
+	policy := retry.Policy{
+		MaxAttempts:  settings.Retry.MaxAttempts,
+		InitialDelay: settings.Retry.InitialDelay,
+		MaxDelay:     settings.Retry.MaxDelay,
+	}
+	runtimeTransport := transport.New(transport.Options{
+		MaxIdleConnsPerHost:   settings.Runtime.MaxIdleConns,
+		IdleConnTimeout:       settings.Runtime.IdleTimeout,
+		ResponseHeaderTimeout: settings.Runtime.ResponseHeaderTimeout,
+	})
+	extensionClient = extension.NewClient(extension.ClientOptions{
+		Transport:      runtimeTransport,
+		DeadlineMargin: settings.Flush.DeadlineMargin,
+	})
+	var registration *extension.RegisterResponse
+	err = policy.Do(ctx, "register", func() error {
+		attemptCtx, cancel := context.WithTimeout(ctx, settings.Timeouts.Register)
+		defer cancel()
+		registration, err = extensionClient.Register(attemptCtx, extension.RegisterOptions{
+			AcceptFeatures: []string{extension.AcceptAccountID},
+		})
+		return err
+	})
 	if err != nil {
-		panic(err)
+		fail(errorRegister, err)
 	}
+	extensionId := registration.ExtensionID
 
-	serverAddress, err := server.Start()
+	protocol := telemetry.HttpProto
+	if settings.Telemetry.Protocol == "tcp" {
+		protocol = telemetry.TcpProto
+	}
+	listener := server.NewListener(server.QueueOptions{
+		Size:   settings.Telemetry.QueueSize,
+		Policy: server.DropPolicy(settings.Telemetry.QueuePolicy),
+	})
+	events := listener.Subscribe()
+	// Binds the listener, returning the URI and port it ended up on
+	listen := func(port int) (string, int, error) {
+		options := server.ListenerOptions{
+			Host:    settings.Telemetry.Host,
+			Port:    port,
+			MaxBody: int64(settings.Telemetry.MaxBody),
+		}
+		if protocol == telemetry.TcpProto {
+			port, err := listener.StartTCP(options)
+			return "", port, err
+		}
+		return listener.Start(options)
+	}
+	serverAddress, serverPort, err := listen(settings.Telemetry.Port)
 	if err != nil {
-		panic(err)
+		fail(errorListener, err)
 	}
 
-	telemetryApiClient := telemetry.NewClient()
-	_, err = telemetryApiClient.Subscribe(ctx, extensionId, serverAddress)
+	telemetryTypes := subscriptionTypes(settings.Telemetry)
+	telemetryApiClient := telemetry.NewClient(telemetry.ClientOptions{Transport: runtimeTransport})
+	subscribe := func(address string, port int) error {
+		return policy.Do(ctx, "subscribe", func() error {
+			attemptCtx, cancel := context.WithTimeout(ctx, settings.Timeouts.Subscribe)
+			defer cancel()
+			_, err := telemetryApiClient.Subscribe(attemptCtx, extensionId, address, telemetry.SubscribeOptions{
+				Buffering: telemetry.BufferingCfg{
+					MaxItems:  uint32(settings.Telemetry.MaxItems),
+					MaxBytes:  uint32(settings.Telemetry.MaxBytes),
+					TimeoutMS: uint32(settings.Telemetry.Timeout.Milliseconds()),
+				},
+				Types:    telemetryTypes,
+				Protocol: protocol,
+				Port:     port,
+			})
+			return err
+		})
+	}
+	if err := subscribe(serverAddress, serverPort); err != nil {
+		fail(errorSubscribe, err)
+	}
+	// Moves the listener to the next port and points the subscription at it
+	resubscribe := func(reason string) {
+		log.Println("[main:resubscribe] Restarting telemetry listener on port", serverPort+1, "after", reason)
+		address, port, err := listen(serverPort + 1)
+		if err != nil {
+			log.Println("[main:resubscribe] Failed to restart listener:", err)
+			return
+		}
+		serverPort = port
+		if err := subscribe(address, serverPort); err != nil {
+			log.Println("[main:resubscribe] Failed to resubscribe:", err)
+		}
+	}
+
+	cfg, _ := awsconfig.LoadDefaultConfig(ctx)
+	sandbox := uuid.New().String()
+	streamName := fmt.Sprintf("%s/%s", time.Now().Format("2006/01/02"), sandbox)
+	names := pipeline.Names{Sandbox: sandbox}
+	sinks, err := buildSinks(cfg, settings, sandbox, streamName)
 	if err != nil {
-		panic(err)
+		fail(errorSink, err)
+	}
+	region := os.Getenv("AWS_REGION")
+	if settings.CloudWatch.Region != "" {
+		region = settings.CloudWatch.Region
+	}
+	recent := summary.NewRecent(100)
+	stats := &pipeline.Stats{}
+	if settings.Admin.Address != "" {
+		endpoint := admin.New(settings.Admin.Address)
+		endpoint.HandleJSON("/invocations/", func(r *http.Request) interface{} {
+			requestID := strings.TrimPrefix(r.URL.Path, "/invocations/")
+			record, ok := recent.Get(requestID)
+			if requestID == "latest" {
+				record, ok = recent.Latest()
+			}
+			if !ok {
+				return nil
+			}
+			return record
+		})
+		endpoint.HandleJSON("/stats", func(r *http.Request) interface{} {
+			snapshot := stats.Snapshot()
+			snapshot.QueueDropped = listener.Dropped()
+			return snapshot
+		})
+		endpoint.Handle("/tail", func(w http.ResponseWriter, r *http.Request) {
+			tail(w, r, listener)
+		})
+		endpoint.HandleJSON("/telemetry", func(r *http.Request) interface{} {
+			// Returned as an untyped nil for the 404 before the first subscription
+			if negotiated := telemetryApiClient.Negotiated(); negotiated != nil {
+				return negotiated
+			}
+			return nil
+		})
+		endpoint.Start()
+	}
+	payloads := processor.NewPayloads()
+	if settings.Proxy.Address != "" {
+		proxy.New(settings.Proxy.Address, func(requestID string, payload []byte) {
+			payloads.Put(requestID, processor.InspectPayload(payload, settings.Proxy.HashPayload))
+		}).Start()
+	}
+	actions := pipeline.NewActionParser(settings.Logs.Markers)
+	levels := &processor.LevelFilter{
+		Min:    processor.ParseLevel(settings.Logs.Level),
+		Format: processor.LogFormat(settings.Logs.Format),
+	}
+	noise, err := processor.NewNoiseFilter(settings.Logs.Noise)
+	if err != nil {
+		fail(errorConfig, err)
+	}
+	patterns, err := processor.NewPatternFilter(settings.Logs.Include, settings.Logs.Exclude)
+	if err != nil {
+		fail(errorConfig, err)
+	}
+	redactor, err := processor.NewRedactor(settings.Logs.Redact, settings.Logs.RedactPatterns, settings.Logs.RedactMask)
+	if err != nil {
+		fail(errorConfig, err)
 	}
 
-	buffer := []string{}
-	var logGroupName string
+	journal, err := wal.Open(wal.Options{
+		Dir:        settings.Flush.SpillDir,
+		MaxBatches: settings.Flush.MaxPending,
+	}, sinks.consumers)
+	if err != nil {
+		fail(errorConfig, err)
+	}
 
-	cfg, _ := config.LoadDefaultConfig(ctx)
-	client := cloudwatchlogs.NewFromConfig(cfg)
-	streamName := fmt.Sprintf("%s/%s", time.Now().Format("2006/01/02"), uuid.New().String())
-	pattern := regexp.MustCompile("::sst::(.+)")
+	logInit(registration, sinks.consumers, sinks.spanSinks, len(sinks.alerters))
+	delivery := &delivery{
+		journal:   journal,
+		sinks:     sinks.sinks,
+		consumers: sinks.consumers,
+		hints:     newHinter(),
+		timeout:   settings.Timeouts.Sink,
+	}
+
+	var echo *passthrough
+	if settings.Logs.DualWrite {
+		echo = newPassthrough(os.Stdout)
+	}
+	correlator := pipeline.NewCorrelator()
+	// Masked as they are kept, before alerts or sinks see anything
+	correlator.Redact(redactor)
+	flusher := newFlusher(ctx, settings.Flush.Queue)
+	// Queues a job on behalf of an event. The event is handled, and its context cancelled,
+	// before the worker gets to the job, so it runs with a context detached from eventCtx
+	// that still ends at the event's deadline. Once the deadline passed, e.g. the function
+	// timed out and a shutdown follows rather than a freeze, it gets LateFlush instead.
+	// Returns the job's context, done once the job ran.
+	handOff := func(eventCtx context.Context, job func(ctx context.Context)) context.Context {
+		jobCtx, cancel := context.WithTimeout(context.Background(), settings.Timeouts.LateFlush)
+		if deadline, ok := eventCtx.Deadline(); ok && eventCtx.Err() == nil {
+			cancel()
+			jobCtx, cancel = context.WithDeadline(context.Background(), deadline)
+		}
+		if !flusher.Submit(jobCtx, func(ctx context.Context) {
+			defer cancel()
+			job(ctx)
+		}) {
+			cancel()
+		}
+		return jobCtx
+	}
+	// Applies settings changed at runtime. Sinks are rebuilt when their settings changed,
+	// settings tagged restart can't change without a cold start and fail the reload.
+	reload := func(next *config.Config) {
+		if fixed := config.RestartRequired(settings, next); len(fixed) > 0 {
+			log.Println("[main:config] Rejecting reloaded settings, these only change on a cold start:", strings.Join(fixed, ", "))
+			return
+		}
+		nextNoise, err := processor.NewNoiseFilter(next.Logs.Noise)
+		if err != nil {
+			log.Println("[main:config] Ignoring reloaded settings:", err)
+			return
+		}
+		nextPatterns, err := processor.NewPatternFilter(next.Logs.Include, next.Logs.Exclude)
+		if err != nil {
+			log.Println("[main:config] Ignoring reloaded settings:", err)
+			return
+		}
+		nextRedactor, err := processor.NewRedactor(next.Logs.Redact, next.Logs.RedactPatterns, next.Logs.RedactMask)
+		if err != nil {
+			log.Println("[main:config] Ignoring reloaded settings:", err)
+			return
+		}
+		var nextSinks *sinkSet
+		if sinksChanged(settings, next) {
+			nextSinks, err = buildSinks(cfg, next, sandbox, streamName)
+			if err != nil {
+				log.Println("[main:config] Ignoring reloaded settings:", err)
+				return
+			}
+		}
+		// Background deliveries read the settings and write to the sinks, nothing runs
+		// once the flusher is idle
+		waitCtx, cancelWait := context.WithTimeout(ctx, settings.Timeouts.Sink)
+		defer cancelWait()
+		if !flusher.Wait(waitCtx) {
+			if nextSinks != nil {
+				nextSinks.Close()
+			}
+			log.Println("[main:config] Ignoring reloaded settings: deliveries still in progress")
+			return
+		}
+		if nextSinks != nil {
+			// The old sinks get what is pending for them first
+			delivery.deliver(waitCtx)
+			journal.SetConsumers(nextSinks.consumers)
+			delivery.sinks, delivery.consumers = nextSinks.sinks, nextSinks.consumers
+			sinks.Close()
+			sinks = nextSinks
+			logInit(registration, sinks.consumers, sinks.spanSinks, len(sinks.alerters))
+		}
+		settings.Logs = next.Logs
+		settings.CloudWatch = next.CloudWatch
+		settings.GRPC = next.GRPC
+		settings.Quickwit = next.Quickwit
+		settings.VictoriaLogs = next.VictoriaLogs
+		settings.Vector = next.Vector
+		settings.S3 = next.S3
+		settings.GCP = next.GCP
+		settings.Azure = next.Azure
+		settings.Sentry = next.Sentry
+		settings.XRay = next.XRay
+		settings.SES = next.SES
+		settings.PagerDuty = next.PagerDuty
+		settings.Summary = next.Summary
+		settings.Retry = next.Retry
+		settings.Flush = next.Flush
+		settings.Diagnostics = next.Diagnostics
+		settings.Timeouts = next.Timeouts
+		policy = retry.Policy{
+			MaxAttempts:  settings.Retry.MaxAttempts,
+			InitialDelay: settings.Retry.InitialDelay,
+			MaxDelay:     settings.Retry.MaxDelay,
+		}
+		delivery.timeout = settings.Timeouts.Sink
+		region = os.Getenv("AWS_REGION")
+		if settings.CloudWatch.Region != "" {
+			region = settings.CloudWatch.Region
+		}
+		noise, patterns = nextNoise, nextPatterns
+		correlator.Redact(nextRedactor)
+		actions = pipeline.NewActionParser(next.Logs.Markers)
+		levels = &processor.LevelFilter{
+			Min:    processor.ParseLevel(next.Logs.Level),
+			Format: processor.LogFormat(next.Logs.Format),
+		}
+		if !next.Logs.DualWrite {
+			echo = nil
+		} else if echo == nil {
+			echo = newPassthrough(os.Stdout)
+		}
+		log.Println("[main:config] Reloaded settings")
+	}
+	// Reads the configuration sources again, with the latest AppConfig profile
+	reloadSources := func() {
+		next, err := config.LoadWith(appConfigDocument)
+		if err != nil {
+			log.Println("[main:config] Ignoring reloaded settings:", err)
+			return
+		}
+		reload(next)
+	}
+	var appConfigUpdates <-chan []byte
+	if appConfig != nil {
+		appConfigUpdates = appConfig.Watch(ctx)
+	}
+	// Log group an invocation's output goes to, the configured default until it splits
+	groupOf := func(state *pipeline.InvocationState) string {
+		group := state.LogGroupName
+		if group == "" {
+			group = settings.Logs.Group
+		}
+		return names.Expand(group, state.RequestID, time.Now())
+	}
+	// Log stream an invocation's output goes to
+	streamOf := func(state *pipeline.InvocationState) string {
+		stream := state.Stream
+		if stream == "" {
+			stream = settings.CloudWatch.Stream
+		}
+		if stream == "" {
+			return sinks.cloudWatch.Stream()
+		}
+		return names.Expand(stream, state.RequestID, time.Now())
+	}
+	// Turns the lines kept for an invocation into its batch, raising an alert for every
+	// distinct error among them. The output of the init phase goes first into the batch of
+	// the first invocation that resolved its group, or that completed without one.
+	toBatch := func(ctx context.Context, state *pipeline.InvocationState) *sink.Batch {
+		lines, notices := state.Lines, state.Notices
+		if init, ok := correlator.Init(); ok && init != state && init.LogGroupName == "" && (state.LogGroupName != "" || !state.Done.IsZero()) {
+			lines = append(append([]pipeline.Line{}, init.Lines...), lines...)
+			notices = append(append([]sink.Entry{}, init.Notices...), notices...)
+			correlator.Remove(init.RequestID)
+		}
+		batch := state.Batch()
+		batch.Group = groupOf(state)
+		if state.Stream != "" || settings.CloudWatch.Stream != "" {
+			batch.Stream = streamOf(state)
+		}
+		batch.Entries = make([]sink.Entry, 0, len(lines)+len(notices))
+		for _, line := range lines {
+			message := line.Message
+			entry := sink.Entry{Time: line.Time, Message: message}
+			level := processor.DetectLevel(message, levels.Format)
+			if level != processor.LevelUnknown {
+				entry.Level = level.String()
+			}
+			if processor.IsError(message, level) {
+				fingerprint := processor.Fingerprint(message)
+				entry.Attributes = map[string]string{"fingerprint": fingerprint}
+				detail := processor.Template(strings.SplitN(message, "\n", 2)[0])
+				if exception := processor.ParseException(message); exception != nil {
+					entry.Attributes["exception.type"] = exception.Type
+					entry.Attributes["exception.message"] = exception.Message
+					if len(exception.Frames) > 0 {
+						top := exception.Frames[0]
+						entry.Attributes["exception.frame"] = fmt.Sprintf("%s %s:%d", top.Function, top.File, top.Line)
+					}
+					detail = fmt.Sprintf("%s: %s", exception.Type, processor.Template(exception.Message))
+				}
+				if !state.Alerted[fingerprint] {
+					state.Alerted[fingerprint] = true
+					raise(ctx, settings.Timeouts.Alert, sinks.alerters, &sink.Alert{
+						Reason:      sink.AlertError,
+						RequestID:   state.RequestID,
+						Group:       groupOf(state),
+						Detail:      detail,
+						Fingerprint: fingerprint,
+						Lines:       []string{message},
+					})
+				}
+			}
+			state.Annotate(&entry)
+			batch.Entries = append(batch.Entries, entry)
+		}
+		for _, entry := range notices {
+			state.Annotate(&entry)
+			batch.Entries = append(batch.Entries, entry)
+		}
+		return batch
+	}
+
+	// Journals a batch, and a copy of it for every further group the invocation's lines
+	// are duplicated to
+	journalBatch := func(state *pipeline.InvocationState, batch *sink.Batch) {
+		journal.Append(*batch)
+		for _, group := range state.Copies {
+			copied := *batch
+			copied.Group = names.Expand(group, state.RequestID, time.Now())
+			journal.Append(copied)
+		}
+	}
+	// Journals whatever an invocation received after its runtimeDone flush and forgets it
+	retire := func(ctx context.Context, state *pipeline.InvocationState) {
+		if !state.Done.IsZero() && !state.Reported && state.Summary != nil {
+			// platform.report never came, the duration is all that is known
+			state.Append(state.Done, fmt.Sprintf("REPORT RequestId: %s\tDuration: %.2f ms", state.RequestID, state.Summary.DurationMs))
+		}
+		if batch := toBatch(ctx, state); len(batch.Entries) > 0 {
+			log.Println("flushing", len(batch.Entries), "remaining entries of", state.RequestID)
+			journalBatch(state, batch)
+		}
+		correlator.Remove(state.RequestID)
+	}
+	// Hands off the lines an invocation kept so far while it keeps running
+	flushPartial := func(ctx context.Context, state *pipeline.InvocationState) {
+		if state.Unsampled {
+			// Held until the outcome decides whether they go out at all
+			return
+		}
+		if batch := toBatch(ctx, state); len(batch.Entries) > 0 {
+			journalBatch(state, batch)
+			handOff(ctx, func(ctx context.Context) { delivery.deliver(ctx) })
+		}
+		state.Clear()
+	}
+	// Delivers everything still buffered and closes the sinks, the last step before exiting
+	finish := func(ctx context.Context) error {
+		// Late lines of completed invocations, and those that never completed, e.g.
+		// because the sandbox crashed
+		for _, state := range correlator.Pending() {
+			retire(ctx, state)
+		}
+		// A delivery still running would race this one over the journal's cursors
+		if !flusher.Stop(ctx) {
+			return errors.New("background delivery didn't stop, its batches stay in the write-ahead log")
+		}
+		err := delivery.deliver(ctx)
+		sinks.Close()
+		return err
+	}
+	// Signalled without a shutdown event, e.g. when run locally. The background flusher
+	// stopped with ctx, so the journal is delivered directly.
+	interrupted := func() {
+		log.Println("interrupted, flushing before exit")
+		finalCtx, cancelFinal := context.WithTimeout(context.Background(), shutdownWindow)
+		defer cancelFinal()
+		finish(finalCtx)
+	}
+	// Reported once per sandbox, it goes on the summary of the first invocation
+	var initSummary *summary.Init
+	// When platform.initStart arrived, for schemas without platform.initReport
+	var initStarted time.Time
+
+	// Processes one event of the telemetry stream, attributing it to fallback while no
+	// invocation is known. Reports true once the awaited invocation completed.
+	handle := func(eventCtx context.Context, evt server.Event, fallback *pipeline.InvocationState, awaited string) bool {
+		// Platform events name their invocation, as do function lines in the runtimes'
+		// formats. Other lines belong to the one that started last, invocations can
+		// overlap with response streaming or concurrent requests.
+		state := correlator.Current()
+		requestID := evt.RequestID()
+		if line, ok := evt.Record.(server.FunctionEvent); ok {
+			requestID = processor.DetectRequestID(string(line), levels.Format)
+		}
+		if requestID != "" {
+			if known, ok := correlator.Lookup(requestID); ok {
+				state = known
+			}
+		}
+		if state == nil {
+			state = fallback
+		}
+		switch evt.Record.(type) {
+		case server.PlatformRuntimeDone, server.PlatformEndEvent:
+			done, ok := completion(correlator, evt)
+			if !ok {
+				log.Println("[main:runtimeDone] Dropping", evt.Type, "of completed or unknown invocation", evt.RequestID())
+				return false
+			}
+			evt.Record = done
+		}
+		switch v := evt.Record.(type) {
+		case server.PlatformInitStartEvent:
+			initStarted = evt.Time
+			state.Append(evt.Time, fmt.Sprintf("INIT_START Runtime Version: %s Runtime Version ARN: %s", v.RuntimeVersion, v.RuntimeVersionArn))
+		case server.PlatformInitRuntimeDoneEvent:
+			// The 2022-07-01 schema has no platform.initReport, the duration is
+			// measured from platform.initStart instead
+			negotiated := telemetryApiClient.Negotiated()
+			if negotiated == nil || negotiated.SchemaVersion != telemetry.SchemaVersion20220701 {
+				return false
+			}
+			durationMs := 0.0
+			if !initStarted.IsZero() {
+				durationMs = float64(evt.Time.Sub(initStarted)) / float64(time.Millisecond)
+			}
+			initSummary = &summary.Init{
+				Type:       v.InitializationType,
+				Phase:      v.Phase,
+				Status:     v.Status,
+				ErrorType:  v.ErrorType,
+				DurationMs: durationMs,
+				Spans:      summarySpans(v.Spans),
+			}
+			state.Append(evt.Time, initReportLine(initSummary))
+		case server.PlatformStartEvent:
+			state = correlator.Start(v.RequestID)
+			state.Started = evt.Time
+			state.Append(evt.Time, fmt.Sprintf("START RequestId: %s Version: %s", v.RequestID, v.Version))
+			// Until the invocation completes the link covers everything up to its deadline
+			if v.Tracing != nil {
+				if started, ok := sink.ParseTraceHeader(v.Tracing.Value); ok {
+					state.Trace = started
+				}
+			}
+			end := state.Deadline
+			if end.IsZero() {
+				end = evt.Time
+			}
+			state.Summary = summary.New(v.RequestID)
+			state.Summary.Link(region, groupOf(state), streamOf(state), evt.Time.Add(-time.Second), end.Add(time.Minute))
+			recent.Add(*state.Summary)
+		case server.FunctionEvent:
+			if echo != nil {
+				echo.Write(string(v))
+			}
+			parsed, err := actions.Parse(string(v))
+			if err != nil {
+				// Reported where the function's logs go, rather than dropped silently
+				name := ""
+				if len(parsed) == 1 {
+					name = parsed[0].Action
+				}
+				log.Println("[main:action] Failed to parse action:", err)
+				state.Warn(evt.Time, actionFailed(name, err))
+				return false
+			}
+			if parsed != nil {
+				if settings.Logs.ForwardActions {
+					state.Append(evt.Time, actions.Redact(string(v), parsed))
+				}
+				for _, action := range parsed {
+					log.Println("action", action.Action)
+					group, copies := state.LogGroupName, state.Copies
+					if err := pipeline.HandleAction(eventCtx, evt.Time, action, state); err != nil {
+						log.Println("[main:action] Failed to handle action:", err)
+						state.Warn(evt.Time, actionFailed(action.Action, err))
+						continue
+					}
+
+					if state.LogGroupName != group || !slices.Equal(state.Copies, copies) {
+						// Lines before the switch stay with the groups they were written
+						// under, unless none was resolved yet
+						if group != "" && (len(state.Lines) > 0 || len(state.Notices) > 0) {
+							split, splitCopies := state.LogGroupName, state.Copies
+							state.LogGroupName, state.Copies = group, copies
+							flushPartial(eventCtx, state)
+							state.LogGroupName, state.Copies = split, splitCopies
+						}
+						log.Println("logGroupName", state.LogGroupName)
+						if record := state.Summary; record != nil {
+							record.Link(region, groupOf(state), streamOf(state), record.Start, record.End)
+							recent.Add(*record)
+						}
+					}
+					if state.FlushRequested {
+						state.FlushRequested = false
+						flushPartial(eventCtx, state)
+					}
+					if state.ReloadRequested {
+						state.ReloadRequested = false
+						reloadSources()
+					}
+				}
+				return false
+			}
+			filter := levels
+			if state.Level != processor.LevelUnknown {
+				filter = &processor.LevelFilter{Min: state.Level, Format: levels.Format}
+			}
+			if !filter.Keep(string(v)) || !noise.Keep(string(v)) || !patterns.Keep(string(v)) {
+				state.Filter()
+				return false
+			}
+			// Late lines of unsampled invocations that succeeded go the way of the rest
+			if state.Unsampled && state.Summary != nil && state.Summary.Status == "success" {
+				state.Filter()
+				return false
+			}
+			// Unsampled invocations only keep the errors, untraced ones everything
+			if settings.Logs.SampledOnly && state.Trace.TraceID != "" && !state.Trace.Sampled && !processor.IsError(string(v), processor.DetectLevel(string(v), levels.Format)) {
+				state.Filter()
+				return false
+			}
+			state.Append(evt.Time, string(v))
+		case server.ExtensionEvent:
+			if echo != nil && echo.Echo(string(v)) {
+				return false
+			}
+			if !levels.Keep(string(v)) || !noise.Keep(string(v)) {
+				state.Filter()
+				return false
+			}
+			state.Append(evt.Time, string(v))
+		case server.PlatformInitReportEvent:
+			initSummary = &summary.Init{
+				Type:       v.InitializationType,
+				Phase:      v.Phase,
+				Status:     v.Status,
+				ErrorType:  v.ErrorType,
+				DurationMs: v.Metrics.DurationMs,
+				Spans:      summarySpans(v.Spans),
+			}
+			state.Append(evt.Time, initReportLine(initSummary))
+		case server.PlatformReportEvent:
+			if state.RequestID != v.RequestID {
+				// Its invocation was retired with a REPORT of its own already
+				log.Println("[main:report] Dropping report of retired invocation", v.RequestID)
+				return false
+			}
+			state.Append(evt.Time, reportLine(v))
+			state.Reported = true
+			// Nothing follows the report, so the buffer kept for late lines can go
+			if !state.Done.IsZero() {
+				retire(eventCtx, state)
+				handOff(eventCtx, func(ctx context.Context) { delivery.deliver(ctx) })
+			}
+		case server.PlatformFaultEvent:
+			state.Faulted = true
+			state.Append(evt.Time, string(v))
+		case server.PlatformLogsDroppedEvent:
+			stats.DroppedRecords.Add(v.DroppedRecords)
+			stats.DroppedBytes.Add(v.DroppedBytes)
+			state.Counters.Dropped += v.DroppedRecords
+			state.DropReasons = append(state.DropReasons, v.Reason)
+			log.Println("[main:logsDropped] Platform dropped", v.DroppedRecords, "records:", v.Reason)
+			state.Warn(evt.Time, fmt.Sprintf("LOGS_DROPPED Records: %d Bytes: %d Reason: %s", v.DroppedRecords, v.DroppedBytes, v.Reason))
+		case server.PlatformRuntimeDone:
+			state = correlator.For(v.RequestID)
+			if reason, ok := runtimeDoneReason(v); ok {
+				raise(eventCtx, settings.Timeouts.Alert, sinks.alerters, &sink.Alert{
+					Reason:    reason,
+					RequestID: v.RequestID,
+					Group:     groupOf(state),
+					Detail:    v.ErrorType,
+					Lines:     state.Tail(alertLines),
+				})
+			}
+			if state.Unsampled && v.Status == "success" {
+				state.Discard()
+			}
+			state.Append(evt.Time, fmt.Sprintf("END RequestId: %s", v.RequestID))
+			if state.Summary == nil {
+				state.Summary = summary.New(v.RequestID)
+				state.Summary.Start = evt.Time.Add(-time.Duration(v.Metrics.DurationMs) * time.Millisecond)
+			}
+			record := state.Summary
+			payload := payloads.Take(v.RequestID)
+			execution := payload.Execution
+			record.PayloadHash = payload.Hash
+			record.DroppedRecords = state.Counters.Dropped
+			record.DroppedReasons = state.DropReasons
+			record.ProducedBytes = v.Metrics.ProducedBytes
+			record.Spans = summarySpans(v.Spans)
+			if v.Tracing != nil {
+				if traced, ok := sink.ParseTraceHeader(v.Tracing.Value); ok {
+					record.TraceID = traced.TraceID
+				}
+			}
+			record.Init = initSummary
+			initSummary = nil
+			if execution != nil {
+				record.ExecutionArn = execution.ExecutionArn
+				record.StateName = execution.StateName
+			}
+			record.Status = v.Status
+			record.ErrorType = v.ErrorType
+			record.DurationMs = v.Metrics.DurationMs
+			// Entries carry the platform's timestamps, the slack covers clock differences
+			record.Link(region, groupOf(state), streamOf(state), record.Start, evt.Time.Add(time.Minute))
+			recent.Add(*record)
+			if settings.Summary.Enabled {
+				line := *record
+				if !settings.Summary.LogURL {
+					line.LogURL = ""
+				}
+				state.Append(evt.Time, line.String())
+			}
+			log.Println("flushing", state.Counters.Lines, "lines,", state.Counters.Filtered, "filtered")
+			if execution != nil {
+				for key, value := range execution.Attributes() {
+					state.Tags[key] = value
+				}
+			}
+			// Kept for the lines the runtime flushes late, until the report arrives
+			state.Done = time.Now()
+			batch := toBatch(eventCtx, state)
+			// Split during init already, so it goes out by itself
+			if init, ok := correlator.Init(); ok && init.LogGroupName != "" {
+				retire(eventCtx, init)
+			}
+			journalBatch(state, batch)
+			var span *sink.Span
+			if len(sinks.spanSinks) > 0 {
+				span = &sink.Span{
+					Trace: state.Trace,
+					Name:  "invocation",
+					Start: record.Start,
+					End:   evt.Time,
+					Fault: v.Status != "" && v.Status != "success",
+					Annotations: map[string]string{
+						"requestId": v.RequestID,
+						"status":    v.Status,
+					},
+				}
+				if v.ErrorType != "" {
+					span.Metadata = map[string]interface{}{"errorType": v.ErrorType}
+				}
+				if sinks.appSignals != nil {
+					sinks.appSignals.Annotate(span)
+				}
+			}
+			var spans []sink.Span
+			if span != nil {
+				span.ID = sink.NewSpanID()
+				spans = append(spans, *span)
+				for _, declared := range state.Spans {
+					declared.Trace = state.Trace
+					declared.Trace.ParentID = span.ID
+					spans = append(spans, declared)
+				}
+			}
+			state.Spans = nil
+			var metrics *sink.Batch
+			if sinks.appSignals != nil {
+				failed := v.Status != "" && v.Status != "success"
+				duration := time.Duration(v.Metrics.DurationMs * float64(time.Millisecond))
+				metrics = &sink.Batch{
+					Group:     sink.ApplicationSignalsGroup,
+					RequestID: v.RequestID,
+					Entries:   []sink.Entry{sinks.appSignals.Metrics(evt.Time, duration, failed)},
+				}
+			}
+			flushCtx := handOff(eventCtx, func(ctx context.Context) {
+				delivery.deliver(ctx)
+				if len(spans) > 0 {
+					for _, s := range sinks.spanSinks {
+						writeCtx, cancelWrite := context.WithTimeout(ctx, settings.Timeouts.Sink)
+						if err := s.WriteSpans(writeCtx, spans); err != nil {
+							log.Println("[main:flush] Failed to write span:", err)
+						}
+						cancelWrite()
+					}
+				}
+				if metrics != nil {
+					writeCtx, cancelWrite := context.WithTimeout(ctx, settings.Timeouts.Sink)
+					if err := sinks.cloudWatch.Write(writeCtx, metrics); err != nil {
+						log.Println("[main:flush] Failed to write Application Signals metrics:", err)
+					}
+					cancelWrite()
+				}
+			})
+			if settings.Flush.Sync {
+				flusher.Wait(flushCtx)
+			}
+			state.Clear()
+			// Telemetry of an earlier invocation may complete while this one runs
+			if v.RequestID == awaited {
+				return true
+			}
+		}
+		if settings.Flush.MaxBytes > 0 && state.Bytes >= settings.Flush.MaxBytes {
+			flushPartial(eventCtx, state)
+		}
+		if settings.Flush.MaxMemory > 0 && correlator.Bytes() > settings.Flush.MaxMemory {
+			correlator.Shed(settings.Flush.MaxMemory, levels.Format, evt.Time)
+		}
+		return false
+	}
 
 	// Will block until invoke or shutdown event is received or cancelled via the context.
 	for {
 		select {
 		case <-ctx.Done():
+			interrupted()
 			return
 		default:
 			// This is a blocking action
-			res, err := extension.EventNext(ctx)
+			var res *extension.NextEventResponse
+			var eventCtx context.Context
+			var done context.CancelFunc
+			err := policy.Do(ctx, "next", func() error {
+				var err error
+				res, eventCtx, done, err = extensionClient.EventNext(ctx)
+				return err
+			})
 			if err != nil {
-				log.Println("Exiting. Error:", err)
-				return
+				if ctx.Err() != nil {
+					interrupted()
+					return
+				}
+				raise(context.Background(), settings.Timeouts.Alert, sinks.alerters, &sink.Alert{
+					Reason: sink.AlertExtension,
+					Detail: err.Error(),
+				})
+				fail(errorEvent, err)
 			}
-			logGroupName = ""
-			buffer = []string{}
+			initialized = true
 
 			if res.EventType == extension.Invoke {
+				select {
+				case document := <-appConfigUpdates:
+					if next, err := config.LoadWith(document); err != nil {
+						log.Println("[main:appconfig] Ignoring invalid AppConfig profile:", err)
+					} else {
+						appConfigDocument = document
+						reload(next)
+					}
+				case <-reloads:
+					reloadSources()
+				default:
+				}
+				invocation := correlator.Begin(res.RequestID, res.Deadline())
+				invocation.Trace, _ = sink.ParseTraceHeader(res.Tracing.Value)
+				invocation.Unsampled = settings.Logs.SampleRate < 1 && rand.Float64() >= settings.Logs.SampleRate
+				expired := correlator.Expired(time.Now().Add(-settings.Flush.LateWindow))
+				for _, state := range expired {
+					retire(eventCtx, state)
+				}
+				// Batches a failed or interrupted flush left behind, or recovered from /tmp,
+				// are retried first
+				if len(expired) > 0 || journal.Len() > 0 {
+					handOff(eventCtx, func(ctx context.Context) { delivery.deliver(ctx) })
+				}
 
-			outerloop:
-				for evt := range server.Events {
-					switch v := evt.Record.(type) {
-					case server.PlatformInitStartEvent:
-						buffer = append(buffer, fmt.Sprintf("INIT_START Runtime Version: %s Runtime Version ARN: %s", v.RuntimeVersion, v.RuntimeVersionArn))
-					case server.PlatformStartEvent:
-						buffer = append(buffer, fmt.Sprintf("START RequestId: %s Version: %s", v.RequestID, v.Version))
-					case server.FunctionEvent:
-						matches := pattern.FindStringSubmatch(string(v))
-						if len(matches) > 1 {
-							log.Println("found matches", matches)
-							var action Action
-							err := json.Unmarshal([]byte(matches[1]), &action)
-							if err != nil {
-								continue
-							}
-
-							log.Println("action", action.Action)
-							if action.Action != "log.split" {
-								continue
-							}
-
-							var logSplitAction LogSplitAction
-							err = json.Unmarshal(action.Properties, &logSplitAction)
-							if err != nil {
-								continue
-							}
+				// Armed until the first event, an invocation always starts with platform.start
+				var heartbeat <-chan time.Time
+				if settings.Telemetry.Heartbeat > 0 {
+					heartbeat = time.After(settings.Telemetry.Heartbeat)
+				}
 
-							logGroupName = logSplitAction.LogGroupName
-							log.Println("logGroupName", logGroupName)
+				// Flushes the lines of long invocations while they run
+				var tick <-chan time.Time
+				var ticker *time.Ticker
+				if settings.Flush.Interval > 0 {
+					ticker = time.NewTicker(settings.Flush.Interval)
+					tick = ticker.C
+				}
 
-							continue
-						}
-						buffer = append(buffer, string(v))
-					case server.PlatformRuntimeDone:
-						buffer = append(buffer, fmt.Sprintf("END RequestId: %s", v.RequestID))
-						buffer = append(buffer, fmt.Sprintf("REPORT RequestId: %s	Duration: %v ms\tBilled Duration: %v ms\tMemory Size: %v MB\tMax Memory Used: %v MB", v.RequestID, v.Metrics.DurationMs, v.Metrics.DurationMs, os.Getenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE"), 0))
-						log.Println("flushing buffer")
-						put := &cloudwatchlogs.PutLogEventsInput{
-							LogGroupName:  aws.String(logGroupName),
-							LogStreamName: aws.String(streamName),
-							LogEvents:     []types.InputLogEvent{},
-						}
-						for _, message := range buffer {
-							put.LogEvents = append(put.LogEvents, types.InputLogEvent{
-								Message:   aws.String(message),
-								Timestamp: aws.Int64(time.Now().UnixNano() / int64(time.Millisecond)),
-							})
+			outerloop:
+				for {
+					var evt server.Event
+					select {
+					case received, ok := <-events:
+						if !ok {
+							break outerloop
 						}
-						for {
-							_, err := client.PutLogEvents(context.Background(), put)
-							if err != nil {
-								var apiErr smithy.APIError
-								if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ResourceNotFoundException" {
-									log.Println("Creating log group")
-									_, err = client.CreateLogGroup(context.Background(), &cloudwatchlogs.CreateLogGroupInput{
-										LogGroupName: aws.String(logGroupName),
-									})
-									if err != nil {
-										log.Println(err)
-									}
-									_, err = client.CreateLogStream(context.Background(), &cloudwatchlogs.CreateLogStreamInput{
-										LogGroupName:  aws.String(logGroupName),
-										LogStreamName: aws.String(streamName),
-									})
-									if err != nil {
-										log.Println(err)
-									}
-									continue
-								}
+						evt = received
+						heartbeat = nil
+					case err := <-listener.Failed():
+						resubscribe(err.Error())
+						continue
+					case <-heartbeat:
+						resubscribe("no telemetry for " + settings.Telemetry.Heartbeat.String())
+						heartbeat = time.After(settings.Telemetry.Heartbeat)
+						continue
+					case <-tick:
+						for _, state := range correlator.Pending() {
+							if len(state.Lines) > 0 {
+								flushPartial(eventCtx, state)
 							}
-							break
 						}
+						continue
+					}
+					if handle(eventCtx, evt, invocation, res.RequestID) {
 						break outerloop
 					}
 				}
+				if ticker != nil {
+					ticker.Stop()
+				}
 			} else if res.EventType == extension.Shutdown {
-				// handle shutdown
+				log.Println("shutting down", res.ShutdownReason)
+				// Events already queued are always delivered. After a crash or timeout the
+				// platform may also still be sending the last logs, so those are waited for
+				// until the deliveries go quiet.
+				until, _ := eventCtx.Deadline()
+				idle := time.Duration(0)
+				if res.ShutdownReason != extension.ShutdownSpindown {
+					idle = settings.Telemetry.Timeout + drainSlack
+				}
+				queued := drain(events, until.Add(-shutdownMargin), idle)
+				shutdownCtx, cancelShutdown := context.WithDeadline(eventCtx, until.Add(-shutdownMargin))
+				listener.Shutdown(shutdownCtx)
+				cancelShutdown()
+				// Whatever arrived while the listener stopped, the channel is closed now
+				queued = append(queued, drain(events, until.Add(-shutdownMargin), 0)...)
+				// Handled like during an invocation, the last one's runtimeDone and report
+				// often come in here after a timeout or crash. Its lines go to the one that
+				// was running, if any.
+				final := correlator.Current()
+				if final == nil {
+					final = correlator.For(res.RequestID)
+				}
+				for _, evt := range queued {
+					handle(eventCtx, evt, final, "")
+				}
+				// Deliveries handed off before, then a last chance for everything buffered and
+				// batches that failed during earlier flushes
+				waitCtx, cancelWait := context.WithDeadline(eventCtx, until.Add(-shutdownMargin))
+				flusher.Wait(waitCtx)
+				cancelWait()
+				if err := finish(eventCtx); err != nil && settings.Diagnostics.Bucket != "" {
+					diagnosticsCtx, cancelDiagnostics := eventCtx, context.CancelFunc(func() {})
+					if eventCtx.Err() != nil {
+						diagnosticsCtx, cancelDiagnostics = context.WithTimeout(context.Background(), settings.Timeouts.LateFlush)
+					}
+					err = writeDiagnostics(diagnosticsCtx, s3.NewFromConfig(cfg), settings, &diagnosticBundle{
+						Type:        "sst.extension.diagnostics",
+						Time:        time.Now(),
+						ExtensionID: extensionId,
+						Function:    os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+						Version:     os.Getenv("AWS_LAMBDA_FUNCTION_VERSION"),
+						ConfigHash:  configHash(settings),
+						Failure:     err.Error(),
+						Errors:      errorLines.Lines(),
+						Pending:     journal.Records(),
+					})
+					if err != nil {
+						log.Println("[main:diagnostics] Failed to write diagnostic bundle:", err)
+					} else {
+						log.Println("[main:diagnostics] Wrote diagnostic bundle to", settings.Diagnostics.Bucket)
+					}
+					cancelDiagnostics()
+				}
+				done()
 				return
 			}
+			done()
+		}
+	}
+}
+
+// Fans batches out of the write-ahead log to the sinks
+type delivery struct {
+	journal *wal.Log
+	sinks   []sink.Sink
+	// Name of each sink in the write-ahead log
+	consumers []string
+	hints     *hinter
+	// Limit on each write
+	timeout time.Duration
+}
+
+// Writes the batches each sink hasn't acknowledged yet, in order. A sink that fails keeps
+// its remaining batches for the next delivery, the others carry on.
+func (d *delivery) deliver(ctx context.Context) error {
+	// Spilled before writing, so a sandbox frozen or killed mid-delivery still has them
+	if err := d.journal.Sync(); err != nil {
+		log.Println("[main:deliver] Failed to sync write-ahead log:", err)
+	}
+	var errs []error
+	for i, s := range d.sinks {
+		for _, record := range d.journal.Pending(d.consumers[i]) {
+			writeCtx, cancel := context.WithTimeout(ctx, d.timeout)
+			err := s.Write(writeCtx, &record.Batch)
+			cancel()
+			if err != nil {
+				log.Println("[main:deliver] Failed to write batch:", err)
+				d.hints.Report(d.consumers[i], err)
+				errs = append(errs, fmt.Errorf("%s: %w", d.consumers[i], err))
+				break
+			}
+			d.journal.Ack(d.consumers[i], record.Seq)
+		}
+	}
+	if err := d.journal.Sync(); err != nil {
+		log.Println("[main:deliver] Failed to sync write-ahead log:", err)
+	}
+	return errors.Join(errs...)
+}
+
+// Names identifying each sink in the write-ahead log, stable across restarts with the same configuration
+func consumerNames(sinks []sink.Sink) []string {
+	names := []string{}
+	seen := map[string]int{}
+	for _, s := range sinks {
+		name := sinkName(s)
+		seen[name]++
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%s#%d", name, seen[name])
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// Lines buffered for a live tail client before it misses some
+const tailBuffer = 256
+
+// Streams function and extension output to an admin client as NDJSON until it disconnects.
+// It watches the listener, so a slow client never holds up delivery.
+func tail(w http.ResponseWriter, r *http.Request, listener *server.Listener) {
+	events, stop := listener.Watch(tailBuffer)
+	defer stop()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case evt, ok := <-events:
+			if !ok {
+				return
+			}
+			var message string
+			switch v := evt.Record.(type) {
+			case server.FunctionEvent:
+				message = string(v)
+			case server.ExtensionEvent:
+				message = string(v)
+			default:
+				continue
+			}
+			err := encoder.Encode(map[string]string{"time": evt.Time.Format(time.RFC3339Nano), "type": evt.Type, "message": message})
+			if err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// Notice written to the invocation's log group for an action that couldn't be applied
+func actionFailed(action string, err error) string {
+	line, _ := json.Marshal(map[string]string{"action": action, "error": err.Error()})
+	return "ACTION_FAILED " + string(line)
+}
+
+// Streams to subscribe to. Metrics-only deployments skip the output streams at the
+// source rather than dropping every line after it was delivered.
+func subscriptionTypes(settings config.Telemetry) []telemetry.EventType {
+	types := []telemetry.EventType{}
+	for _, kind := range settings.Types {
+		eventType := telemetry.EventType(kind)
+		if settings.MetricsOnly && eventType != telemetry.Platform {
+			continue
+		}
+		types = append(types, eventType)
+	}
+	return types
+}
+
+func summarySpans(spans []server.Span) []summary.Span {
+	if len(spans) == 0 {
+		return nil
+	}
+	converted := make([]summary.Span, 0, len(spans))
+	for _, span := range spans {
+		converted = append(converted, summary.Span{Name: span.Name, Start: span.Start, DurationMs: span.DurationMs})
+	}
+	return converted
+}
+
+// Renders platform.report the way the Lambda runtime writes REPORT lines
+func reportLine(report server.PlatformReportEvent) string {
+	line := fmt.Sprintf("REPORT RequestId: %s\tDuration: %.2f ms\tBilled Duration: %d ms\tMemory Size: %d MB\tMax Memory Used: %d MB",
+		report.RequestID, report.Metrics.DurationMs, report.Metrics.BilledDurationMs, report.Metrics.MemorySizeMb, report.Metrics.MaxMemoryUsedMb)
+	if report.Metrics.InitDurationMs > 0 {
+		line += fmt.Sprintf("\tInit Duration: %.2f ms", report.Metrics.InitDurationMs)
+	}
+	return line
+}
+
+// Formats the INIT_REPORT line Lambda writes for the init phase
+func initReportLine(init *summary.Init) string {
+	line := fmt.Sprintf("INIT_REPORT Init Duration: %.2f ms\tPhase: %s\tStatus: %s", init.DurationMs, init.Phase, init.Status)
+	if init.ErrorType != "" {
+		line += "\tError Type: " + init.ErrorType
+	}
+	return line
+}
+
+// Collects telemetry events until the given time, or until no event arrived for the
+// idle period. With no idle period only the events already queued are collected.
+func drain(events <-chan server.Event, until time.Time, idle time.Duration) []server.Event {
+	queued := []server.Event{}
+	if idle == 0 {
+		for {
+			select {
+			case evt, ok := <-events:
+				if !ok {
+					return queued
+				}
+				queued = append(queued, evt)
+			default:
+				return queued
+			}
+		}
+	}
+	timer := time.NewTimer(time.Until(until))
+	defer timer.Stop()
+	for {
+		select {
+		case evt, ok := <-events:
+			if !ok {
+				return queued
+			}
+			queued = append(queued, evt)
+		case <-timer.C:
+			return queued
+		case <-time.After(idle):
+			return queued
+		}
+	}
+}
+
+// Notifies every alerter, giving them a bounded amount of time even when shutting down
+func raise(parent context.Context, timeout time.Duration, alerters []sink.Alerter, alert *sink.Alert) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	for _, alerter := range alerters {
+		err := alerter.Alert(ctx, alert)
+		if err != nil {
+			log.Println("[main:raise] Failed to send alert:", err)
+		}
+	}
+}
+
+// Runs one of the offline commands used by deploy tooling instead of the extension itself
+func command(name string) {
+	switch name {
+	case "print-schema":
+		schema, err := config.Schema()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(schema))
+	case "validate":
+		_, err := config.Load()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		for _, name := range config.Unknown() {
+			fmt.Fprintln(os.Stderr, "unknown setting", name)
 		}
+		fmt.Println("configuration is valid")
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, expected print-schema or validate\n", name)
+		os.Exit(2)
 	}
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sst/extension/pipeline"
+	"github.com/sst/extension/server"
+)
+
+const requestID = "6d68ca91-49c9-448d-89b8-7ca3e6dc66aa"
+
+var started = time.Date(2024, 3, 5, 10, 15, 2, 313000000, time.UTC)
+
+func event(at time.Time, record interface{}) server.Event {
+	return server.Event{Time: at, Record: record}
+}
+
+// Feeds the records like the handler does: whatever completes the invocation flushes it
+func complete(correlator *pipeline.Correlator, events ...server.Event) []server.PlatformRuntimeDone {
+	var completed []server.PlatformRuntimeDone
+	for _, evt := range events {
+		if done, ok := completion(correlator, evt); ok {
+			correlator.For(done.RequestID).Done = evt.Time
+			completed = append(completed, done)
+		}
+	}
+	return completed
+}
+
+func TestCompletionUnderLogsAPI(t *testing.T) {
+	runtimeDone := event(started.Add(39*time.Millisecond), server.PlatformRuntimeDone{
+		RequestID: requestID,
+		Status:    "timeout",
+		Metrics:   server.RuntimeDoneMetrics{DurationMs: 39.53},
+	})
+	end := event(started.Add(40*time.Millisecond), server.PlatformEndEvent{RequestID: requestID})
+	cases := []struct {
+		name    string
+		faulted bool
+		events  []server.Event
+		want    server.PlatformRuntimeDone
+	}{
+		{
+			"runtimeDone before end",
+			false,
+			[]server.Event{runtimeDone, end},
+			runtimeDone.Record.(server.PlatformRuntimeDone),
+		},
+		{
+			"end before runtimeDone",
+			false,
+			[]server.Event{end, runtimeDone},
+			server.PlatformRuntimeDone{RequestID: requestID, Status: "success", Metrics: server.RuntimeDoneMetrics{DurationMs: 40}},
+		},
+		{
+			"end alone",
+			false,
+			[]server.Event{end},
+			server.PlatformRuntimeDone{RequestID: requestID, Status: "success", Metrics: server.RuntimeDoneMetrics{DurationMs: 40}},
+		},
+		{
+			"end after a fault",
+			true,
+			[]server.Event{end},
+			server.PlatformRuntimeDone{RequestID: requestID, Status: "failure", Metrics: server.RuntimeDoneMetrics{DurationMs: 40}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			correlator := pipeline.NewCorrelator()
+			state := correlator.Start(requestID)
+			state.Started = started
+			state.Faulted = c.faulted
+			completed := complete(correlator, c.events...)
+			if len(completed) != 1 {
+				t.Fatalf("completed %d times, want once", len(completed))
+			}
+			if !reflect.DeepEqual(completed[0], c.want) {
+				t.Errorf("completed with %+v, want %+v", completed[0], c.want)
+			}
+		})
+	}
+}
+
+func TestCompletionOfUnknownInvocation(t *testing.T) {
+	correlator := pipeline.NewCorrelator()
+	if _, ok := completion(correlator, event(started, server.PlatformEndEvent{RequestID: requestID})); ok {
+		t.Error("platform.end of an invocation that never started completed it")
+	}
+	if _, ok := completion(correlator, event(started, server.PlatformRuntimeDone{RequestID: requestID, Status: "success"})); !ok {
+		t.Error("runtimeDone of an invocation without platform.start was dropped")
+	}
+}
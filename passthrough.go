@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io"
+	"strings"
+)
+
+// Lines passed through that weren't seen back yet, past this they are forgotten
+const passthroughPending = 4096
+
+// Writes function log lines to the extension's stdout as well, so they keep landing in
+// the function's own log group while they are also split. Lambda captures the extension's
+// output and delivers it back as extension lines, those are recognized so they aren't
+// split a second time.
+type passthrough struct {
+	out     io.Writer
+	pending map[string]int
+}
+
+func newPassthrough(out io.Writer) *passthrough {
+	return &passthrough{out: out, pending: map[string]int{}}
+}
+
+func (p *passthrough) Write(message string) {
+	message = strings.TrimSuffix(message, "\n")
+	if len(p.pending) >= passthroughPending {
+		p.pending = map[string]int{}
+	}
+	// Lambda splits the output into lines
+	for _, line := range strings.Split(message, "\n") {
+		p.pending[line]++
+	}
+	io.WriteString(p.out, message+"\n")
+}
+
+// Reports whether an extension line is one passed through, forgetting it
+func (p *passthrough) Echo(line string) bool {
+	line = strings.TrimSuffix(line, "\n")
+	count, ok := p.pending[line]
+	if !ok {
+		return false
+	}
+	if count == 1 {
+		delete(p.pending, line)
+	} else {
+		p.pending[line] = count - 1
+	}
+	return true
+}
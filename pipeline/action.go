@@ -0,0 +1,263 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sst/extension/config"
+	"github.com/sst/extension/processor"
+)
+
+// Latest version of the action envelope understood
+const ActionVersion = 1
+
+// In-band instruction a function writes to its logs as ::sst::{"action": ..., "properties": ...},
+// or several at once as ::sst::[{"action": ...}, ...]
+type Action struct {
+	// Version of the envelope, envelopes without one are version 1
+	Version    int             `json:"version,omitempty"`
+	Action     string          `json:"action"`
+	Properties json.RawMessage `json:"properties"`
+}
+
+// Finds actions introduced by any of a set of markers
+type ActionParser struct {
+	markers []string
+}
+
+// Builds a parser for the given markers, no markers disables actions
+func NewActionParser(markers []string) *ActionParser {
+	return &ActionParser{markers: markers}
+}
+
+// Extracts the actions from a function log line, written either as one envelope or as
+// an array of them. Returns nil for the vast majority of lines that carry none, without
+// scanning them with a regex. Lines with a marker whose actions can't all be used return
+// an error along with the actions that could be decoded, and none of them is applied.
+func (p *ActionParser) Parse(line string) ([]Action, error) {
+	start, end := p.payload(line)
+	if start < 0 {
+		return nil, nil
+	}
+	raw := []byte(strings.TrimRight(line[start:end], "\r"))
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, nil
+	}
+	var actions []Action
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+		if err := json.Unmarshal(raw, &actions); err != nil {
+			return nil, fmt.Errorf("malformed action: %w", err)
+		}
+		if len(actions) == 0 {
+			return nil, nil
+		}
+	} else {
+		var action Action
+		if err := json.Unmarshal(raw, &action); err != nil {
+			return nil, fmt.Errorf("malformed action: %w", err)
+		}
+		actions = []Action{action}
+	}
+	for _, action := range actions {
+		if action.Version > ActionVersion {
+			return actions, fmt.Errorf("unsupported action version %d, at most %d is understood", action.Version, ActionVersion)
+		}
+		if action.Action == "" {
+			return actions, errors.New("malformed action: missing action name")
+		}
+	}
+	return actions, nil
+}
+
+// Returns the line actions were parsed from with their properties left out, for
+// forwarding action lines without the data they carry
+func (p *ActionParser) Redact(line string, actions []Action) string {
+	start, end := p.payload(line)
+	if start < 0 {
+		return line
+	}
+	redacted := make([]map[string]string, len(actions))
+	for i, action := range actions {
+		redacted[i] = map[string]string{"action": action.Action, "properties": "[redacted]"}
+	}
+	var payload []byte
+	if strings.HasPrefix(strings.TrimSpace(line[start:end]), "[") {
+		payload, _ = json.Marshal(redacted)
+	} else if len(redacted) == 1 {
+		payload, _ = json.Marshal(redacted[0])
+	}
+	return line[:start] + string(payload) + line[end:]
+}
+
+// Bounds of the payload following the earliest marker in the line, which runs to the end
+// of its first line. -1 if there is no marker.
+func (p *ActionParser) payload(line string) (int, int) {
+	index, marker := p.find(line)
+	if index < 0 {
+		return -1, -1
+	}
+	start := index + len(marker)
+	end := len(line)
+	if newline := strings.IndexByte(line[start:], '\n'); newline >= 0 {
+		end = start + newline
+	}
+	return start, end
+}
+
+// Finds the earliest marker in the line, -1 if there is none
+func (p *ActionParser) find(line string) (int, string) {
+	index, marker := -1, ""
+	for _, candidate := range p.markers {
+		if i := strings.Index(line, candidate); i >= 0 && (index < 0 || i < index) {
+			index, marker = i, candidate
+		}
+	}
+	return index, marker
+}
+
+// Handles the properties of one action written at the given time. Returned errors are
+// logged, the line is dropped either way.
+type ActionHandler func(ctx context.Context, at time.Time, properties json.RawMessage, state *InvocationState) error
+
+// Adapts a handler taking the action's properties decoded into T, e.g. a struct with
+// json tags. Actions without properties get the zero value.
+func TypedAction[T any](handler func(ctx context.Context, at time.Time, properties T, state *InvocationState) error) ActionHandler {
+	return func(ctx context.Context, at time.Time, raw json.RawMessage, state *InvocationState) error {
+		var properties T
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &properties); err != nil {
+				return fmt.Errorf("invalid properties: %w", err)
+			}
+		}
+		return handler(ctx, at, properties, state)
+	}
+}
+
+var (
+	actionsMu sync.RWMutex
+	actions   = map[string]ActionHandler{}
+)
+
+// Makes an action available under name, replacing any handler registered before,
+// including built-in ones. Call it before the extension starts handling events.
+func RegisterAction(name string, handler ActionHandler) {
+	actionsMu.Lock()
+	defer actionsMu.Unlock()
+	actions[name] = handler
+}
+
+// Runs the handler registered for the action, written on a line the platform recorded at the given time
+func HandleAction(ctx context.Context, at time.Time, action Action, state *InvocationState) error {
+	state.Counters.Actions++
+	actionsMu.RLock()
+	handler, ok := actions[action.Action]
+	actionsMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown action %q", action.Action)
+	}
+	return handler(ctx, at, action.Properties, state)
+}
+
+type logSplit struct {
+	LogGroupName groupNames `json:"logGroupName"`
+}
+
+// One log group name, or a list of them
+type groupNames []string
+
+func (g *groupNames) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*g = groupNames{name}
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return errors.New("logGroupName must be a string or a list of strings")
+	}
+	*g = names
+	return nil
+}
+
+type logRetention struct {
+	Days int `json:"days"`
+}
+
+type logStream struct {
+	LogStreamName string `json:"logStreamName"`
+}
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+func init() {
+	// Applies to the rest of the invocation, an empty level restores the configured one
+	RegisterAction("log.level", TypedAction(func(ctx context.Context, at time.Time, properties logLevel, state *InvocationState) error {
+		level := processor.ParseLevel(properties.Level)
+		if level == processor.LevelUnknown && properties.Level != "" {
+			return fmt.Errorf("log.level: unknown level %q", properties.Level)
+		}
+		state.Level = level
+		return nil
+	}))
+	// Fields added to the invocation's entries, null removes one
+	RegisterAction("log.tag", TypedAction(func(ctx context.Context, at time.Time, fields map[string]interface{}, state *InvocationState) error {
+		for key, value := range fields {
+			switch value.(type) {
+			case nil, string, float64, bool:
+			default:
+				return fmt.Errorf("log.tag: %s must be a string, number or boolean", key)
+			}
+		}
+		for key, value := range fields {
+			if value == nil {
+				delete(state.Tags, key)
+			} else {
+				state.Tags[key] = fmt.Sprint(value)
+			}
+		}
+		return nil
+	}))
+	// Delivers what the invocation logged so far, e.g. at checkpoints of long handlers
+	RegisterAction("log.flush", func(ctx context.Context, at time.Time, properties json.RawMessage, state *InvocationState) error {
+		state.FlushRequested = true
+		return nil
+	})
+	// Re-reads the configuration files and the AppConfig profile, applied right after the action
+	RegisterAction("config.reload", func(ctx context.Context, at time.Time, properties json.RawMessage, state *InvocationState) error {
+		state.ReloadRequested = true
+		return nil
+	})
+	// Sets the retention of the invocation's log group, once per sandbox and value
+	RegisterAction("log.retention", TypedAction(func(ctx context.Context, at time.Time, properties logRetention, state *InvocationState) error {
+		if !config.ValidRetention(properties.Days) {
+			return fmt.Errorf("log.retention: not a retention CloudWatch Logs accepts, got %d", properties.Days)
+		}
+		state.Retention = properties.Days
+		return nil
+	}))
+	// Overrides the log stream, e.g. to group by tenant. Names accept the same placeholders
+	// as the configured one, an empty name restores it
+	RegisterAction("log.stream", TypedAction(func(ctx context.Context, at time.Time, properties logStream, state *InvocationState) error {
+		if strings.ContainsAny(properties.LogStreamName, ":*") {
+			return fmt.Errorf("log.stream: %q contains : or *", properties.LogStreamName)
+		}
+		state.Stream = properties.LogStreamName
+		return nil
+	}))
+	// Routes the lines from here on, a list duplicates them to every group in it
+	RegisterAction("log.split", TypedAction(func(ctx context.Context, at time.Time, split logSplit, state *InvocationState) error {
+		state.LogGroupName, state.Copies = "", nil
+		if len(split.LogGroupName) > 0 {
+			state.LogGroupName, state.Copies = split.LogGroupName[0], split.LogGroupName[1:]
+		}
+		return nil
+	}))
+}
@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sst/extension/processor"
+)
+
+// Groups telemetry by the invocation it belongs to. Platform events carry their requestId,
+// function lines that don't are attributed to the invocation that started last. Telemetry for an
+// invocation can still be arriving after the next one was handed out by EventNext, so the
+// state of every invocation that hasn't been flushed is kept.
+//
+// Output of the init phase, before the first platform.start, is kept apart under an empty
+// requestId until an invocation resolves the group it goes to.
+type Correlator struct {
+	states map[string]*InvocationState
+	// Invocation function lines are attributed to
+	current string
+	// Handed to every state, see InvocationState.Redactor
+	redactor *processor.Redactor
+}
+
+func NewCorrelator() *Correlator {
+	return &Correlator{states: map[string]*InvocationState{
+		"": NewInvocationState("", time.Time{}),
+	}}
+}
+
+// Records an invocation handed out by EventNext. Its function lines are only attributed
+// to it once platform.start arrives, as those of the previous one may still be queued
+// before it, unless nothing else is in progress.
+func (c *Correlator) Begin(requestID string, deadline time.Time) *InvocationState {
+	state := c.For(requestID)
+	state.Deadline = deadline
+	if _, ok := c.states[c.current]; !ok {
+		c.current = requestID
+	}
+	return state
+}
+
+// Marks the invocation platform.start was received for as the one producing output
+func (c *Correlator) Start(requestID string) *InvocationState {
+	c.current = requestID
+	return c.For(requestID)
+}
+
+// Returns the state of an invocation, creating it on its first event
+func (c *Correlator) For(requestID string) *InvocationState {
+	state, ok := c.states[requestID]
+	if !ok {
+		state = NewInvocationState(requestID, time.Time{})
+		state.Redactor = c.redactor
+		c.states[requestID] = state
+	}
+	return state
+}
+
+// Masks the lines and notices kept from now on with redactor, for every invocation
+func (c *Correlator) Redact(redactor *processor.Redactor) {
+	c.redactor = redactor
+	for _, state := range c.states {
+		state.Redactor = redactor
+	}
+}
+
+// Returns the state of an invocation only if it hasn't been flushed
+func (c *Correlator) Lookup(requestID string) (*InvocationState, bool) {
+	state, ok := c.states[requestID]
+	return state, ok
+}
+
+// Returns the output of the init phase, unless it was replayed already
+func (c *Correlator) Init() (*InvocationState, bool) {
+	return c.Lookup("")
+}
+
+// Returns the state function lines are attributed to, nil before any invocation
+func (c *Correlator) Current() *InvocationState {
+	return c.states[c.current]
+}
+
+// Forgets an invocation once it was flushed
+func (c *Correlator) Remove(requestID string) {
+	delete(c.states, requestID)
+}
+
+// Returns the invocations flushed on platform.runtimeDone before the given time, whose
+// platform.report never arrived
+func (c *Correlator) Expired(before time.Time) []*InvocationState {
+	var states []*InvocationState
+	for _, state := range c.states {
+		if !state.Done.IsZero() && state.Done.Before(before) {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// Returns every invocation that hasn't been flushed, e.g. to deliver them on shutdown
+func (c *Correlator) Pending() []*InvocationState {
+	states := make([]*InvocationState, 0, len(c.states))
+	for _, state := range c.states {
+		states = append(states, state)
+	}
+	return states
+}
+
+// Size of the lines buffered across invocations
+func (c *Correlator) Bytes() int {
+	bytes := 0
+	for _, state := range c.states {
+		bytes += state.Bytes
+	}
+	return bytes
+}
+
+// Levels shed in turn once the buffered lines outgrow their limit
+var shedLevels = []processor.Level{processor.LevelDebug, processor.LevelInfo, processor.LevelWarn, processor.LevelError}
+
+// Keeps the lines buffered across invocations within limit bytes, dropping the least
+// important first: TRACE, then DEBUG, INFO and WARN lines. Errors are always kept. Each
+// invocation that lost lines gets a notice saying how many.
+func (c *Correlator) Shed(limit int, format processor.LogFormat, at time.Time) {
+	lines, bytes := map[*InvocationState]int{}, map[*InvocationState]int{}
+	for _, below := range shedLevels {
+		if c.Bytes() <= limit {
+			break
+		}
+		for _, state := range c.states {
+			n, size := state.Shed(below, format)
+			lines[state] += n
+			bytes[state] += size
+		}
+	}
+	for state, n := range lines {
+		if n > 0 {
+			state.Warn(at, fmt.Sprintf("LOGS_SHED Records: %d Bytes: %d Reason: buffered telemetry over %d bytes", n, bytes[state], limit))
+		}
+	}
+}
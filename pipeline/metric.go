@@ -0,0 +1,48 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/sst/extension/sink"
+)
+
+// Namespace of metrics put without one
+const defaultMetricNamespace = "SST"
+
+// Properties of a metric.put action, e.g.
+//
+//	::sst::{"action":"metric.put","properties":{"name":"OrdersPlaced","value":1,"unit":"Count","dimensions":{"Tenant":"acme"}}}
+type metricPut struct {
+	Namespace  string            `json:"namespace"`
+	Name       string            `json:"name"`
+	Value      float64           `json:"value"`
+	Unit       string            `json:"unit"`
+	Dimensions map[string]string `json:"dimensions"`
+}
+
+func init() {
+	// Written to the invocation's log group as EMF, stamped with the line's time, so the
+	// handler never waits on PutMetricData
+	RegisterAction("metric.put", TypedAction(func(ctx context.Context, at time.Time, put metricPut, state *InvocationState) error {
+		if put.Name == "" {
+			return errors.New("metric.put: name is required")
+		}
+		if math.IsNaN(put.Value) || math.IsInf(put.Value, 0) {
+			return errors.New("metric.put: value must be a finite number")
+		}
+		if len(put.Dimensions) > 30 {
+			return errors.New("metric.put: at most 30 dimensions are allowed")
+		}
+		namespace := put.Namespace
+		if namespace == "" {
+			namespace = defaultMetricNamespace
+		}
+		state.Notify(sink.EMF(namespace, at, put.Dimensions, []sink.Metric{
+			{Name: put.Name, Unit: put.Unit, Value: put.Value},
+		}))
+		return nil
+	}))
+}
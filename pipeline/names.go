@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// Fills in the placeholders of a log group or stream name, so one configuration serves
+// every function and stage:
+//
+//	{functionName}     name of the function
+//	{functionVersion}  version of the function
+//	{date}             day of the write as 2006/01/02, in UTC
+//	{requestId}        invocation the logs belong to
+//	{sandbox}          identifier of the sandbox the extension runs in
+//	{env:NAME}         value of the environment variable NAME
+//
+// Unknown placeholders are kept as they are.
+type Names struct {
+	// Identifier of the sandbox
+	Sandbox string
+}
+
+// Expands the placeholders of name for an invocation's write at the given time
+func (n Names) Expand(name string, requestID string, at time.Time) string {
+	if !strings.Contains(name, "{") {
+		return name
+	}
+	var out strings.Builder
+	for {
+		start := strings.Index(name, "{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(name[start:], "}")
+		if end < 0 {
+			break
+		}
+		end += start
+		out.WriteString(name[:start])
+		placeholder := name[start+1 : end]
+		if value, ok := n.value(placeholder, requestID, at); ok {
+			out.WriteString(value)
+		} else {
+			out.WriteString(name[start : end+1])
+		}
+		name = name[end+1:]
+	}
+	out.WriteString(name)
+	return out.String()
+}
+
+func (n Names) value(placeholder string, requestID string, at time.Time) (string, bool) {
+	switch placeholder {
+	case "functionName":
+		return os.Getenv("AWS_LAMBDA_FUNCTION_NAME"), true
+	case "functionVersion":
+		return os.Getenv("AWS_LAMBDA_FUNCTION_VERSION"), true
+	case "date":
+		return at.UTC().Format("2006/01/02"), true
+	case "requestId":
+		return requestID, true
+	case "sandbox":
+		return n.Sandbox, true
+	}
+	if name, ok := strings.CutPrefix(placeholder, "env:"); ok {
+		return os.Getenv(name), true
+	}
+	return "", false
+}
@@ -0,0 +1,44 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sst/extension/sink"
+)
+
+// Properties of a trace.span action, e.g.
+//
+//	::sst::{"action":"trace.span","properties":{"name":"charge","start":"2024-05-01T12:00:00.120Z","end":"2024-05-01T12:00:00.480Z"}}
+type traceSpan struct {
+	Name        string                 `json:"name"`
+	Start       time.Time              `json:"start"`
+	End         time.Time              `json:"end"`
+	Error       bool                   `json:"error"`
+	Fault       bool                   `json:"fault"`
+	Annotations map[string]string      `json:"annotations"`
+	Metadata    map[string]interface{} `json:"metadata"`
+}
+
+func init() {
+	// The span becomes a child of the invocation's span once the invocation completes
+	RegisterAction("trace.span", TypedAction(func(ctx context.Context, at time.Time, span traceSpan, state *InvocationState) error {
+		if span.Name == "" {
+			return errors.New("trace.span: name is required")
+		}
+		if span.Start.IsZero() || span.End.Before(span.Start) {
+			return errors.New("trace.span: start and an end not before it are required")
+		}
+		state.Spans = append(state.Spans, sink.Span{
+			Name:        span.Name,
+			Start:       span.Start,
+			End:         span.End,
+			Error:       span.Error,
+			Fault:       span.Fault,
+			Annotations: span.Annotations,
+			Metadata:    span.Metadata,
+		})
+		return nil
+	}))
+}
@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/sst/extension/processor"
+	"github.com/sst/extension/sink"
+	"github.com/sst/extension/summary"
+)
+
+// Counts of what happened to the function's lines during an invocation
+type Counters struct {
+	// Lines kept for delivery
+	Lines int
+	// Lines dropped by the level, noise or sampling filters
+	Filtered int
+	// In-band actions handled, including failed ones
+	Actions int
+	// Records the platform discarded before they reached the extension
+	Dropped int64
+	// Lines dropped to keep the buffered telemetry within its memory limit
+	Shed int
+}
+
+// Everything known about one invocation. The correlator keeps one per requestId, shared
+// by all of the invocation's events from the first until it is flushed, so nothing leaks
+// from one invocation into the next.
+type InvocationState struct {
+	RequestID string
+	// Zero for events without a deadline
+	Deadline time.Time
+	// Log group the invocation's batch is written to, empty for the function's own
+	LogGroupName string
+	// Further log groups the batch is duplicated to
+	Copies []string
+	// Log stream set by log.stream, empty for the configured one
+	Stream string
+	// Retention of the log group set by log.retention, 0 leaves it as it is
+	Retention int
+	// Minimum level of the lines forwarded, set by log.level. LevelUnknown for the configured one
+	Level processor.Level
+	// Masks sensitive values of every line and notice as it is kept, nil keeps them as they are
+	Redactor *processor.Redactor
+	// Attributes added to every entry of the batch
+	Tags  map[string]string
+	Lines []Line
+	// Size of the messages in Lines
+	Bytes int
+	// Entries written by the extension itself, delivered after the lines
+	Notices []sink.Entry
+	// Reasons the platform gave for dropping telemetry
+	DropReasons []string
+	Counters    Counters
+	// Trace the invocation is part of, from its invoke event or platform.start
+	Trace sink.TraceContext
+	// Spans the function declared with trace.span, delivered with the invocation's own
+	Spans []sink.Span
+	// Summary record, started by platform.start
+	Summary *summary.Record
+	// Fingerprints of the errors alerted on, so flushing in parts doesn't repeat alerts
+	Alerted map[string]bool
+	// Set when the invocation lost the sampling draw. Its lines are held until it completes,
+	// and only delivered if it failed.
+	Unsampled bool
+	// Set by log.flush, the lines kept so far are handed off right after the action
+	FlushRequested bool
+	// Set by config.reload, the settings are read again right after the action
+	ReloadRequested bool
+	// When platform.start arrived, zero before
+	Started time.Time
+	// Set by a Logs API platform.fault, the outcome platform.end doesn't report
+	Faulted bool
+	// Set once platform.report arrived
+	Reported bool
+	// When the invocation was flushed on platform.runtimeDone, zero before. Lines the
+	// runtime writes after it are kept for a second flush.
+	Done time.Time
+}
+
+func NewInvocationState(requestID string, deadline time.Time) *InvocationState {
+	return &InvocationState{
+		RequestID: requestID,
+		Deadline:  deadline,
+		Tags:      map[string]string{},
+		Alerted:   map[string]bool{},
+		// Sized for a typical invocation so chatty functions don't regrow it line by line
+		Lines: make([]Line, 0, 64),
+	}
+}
+
+// A line kept for delivery, stamped with the time the platform recorded it at
+type Line struct {
+	Time    time.Time
+	Message string
+}
+
+// Keeps a line for delivery
+func (s *InvocationState) Append(at time.Time, message string) {
+	message = s.Redactor.Redact(message)
+	s.Lines = append(s.Lines, Line{Time: at, Message: message})
+	s.Bytes += len(message)
+	s.Counters.Lines++
+}
+
+// Messages of the last n lines, for alerts
+func (s *InvocationState) Tail(n int) []string {
+	lines := s.Lines[max(0, len(s.Lines)-n):]
+	messages := make([]string, len(lines))
+	for i, line := range lines {
+		messages[i] = line.Message
+	}
+	return messages
+}
+
+// Records a line that was dropped
+func (s *InvocationState) Filter() {
+	s.Counters.Filtered++
+}
+
+// Forgets the lines and notices once they were flushed, the counters remain
+func (s *InvocationState) Clear() {
+	s.Lines = s.Lines[:0]
+	s.Bytes = 0
+	s.Notices = nil
+}
+
+// Drops the buffered lines of an unsampled invocation that succeeded, counting them as
+// filtered. Notices stay.
+func (s *InvocationState) Discard() {
+	s.Counters.Lines -= len(s.Lines)
+	s.Counters.Filtered += len(s.Lines)
+	s.Lines = s.Lines[:0]
+	s.Bytes = 0
+}
+
+// Drops the buffered lines below the given level, except errors, returning how many
+// lines and bytes went. Lines without a level count as INFO.
+func (s *InvocationState) Shed(below processor.Level, format processor.LogFormat) (int, int) {
+	lines, bytes := 0, 0
+	kept := s.Lines[:0]
+	for _, line := range s.Lines {
+		level := processor.DetectLevel(line.Message, format)
+		if level == processor.LevelUnknown {
+			level = processor.LevelInfo
+		}
+		if level < below && !processor.IsError(line.Message, level) {
+			lines++
+			bytes += len(line.Message)
+			continue
+		}
+		kept = append(kept, line)
+	}
+	clear(s.Lines[len(kept):])
+	s.Lines = kept
+	s.Bytes -= bytes
+	s.Counters.Shed += lines
+	return lines, bytes
+}
+
+// Reports a problem with the invocation's telemetry in its own log group
+func (s *InvocationState) Warn(at time.Time, message string) {
+	s.Notify(sink.Entry{Time: at, Message: message, Level: processor.LevelWarn.String()})
+}
+
+// Keeps an entry written by the extension for delivery after the lines
+func (s *InvocationState) Notify(entry sink.Entry) {
+	entry.Message = s.Redactor.Redact(entry.Message)
+	s.Notices = append(s.Notices, entry)
+}
+
+// Starts the batch the invocation's lines are delivered in, routed to its log group
+func (s *InvocationState) Batch() *sink.Batch {
+	return &sink.Batch{Group: s.LogGroupName, RequestID: s.RequestID, Retention: s.Retention}
+}
+
+// Adds the invocation's tags to an entry, attributes already on it win
+func (s *InvocationState) Annotate(entry *sink.Entry) {
+	if len(s.Tags) == 0 {
+		return
+	}
+	if entry.Attributes == nil {
+		entry.Attributes = map[string]string{}
+	}
+	for key, value := range s.Tags {
+		if _, ok := entry.Attributes[key]; !ok {
+			entry.Attributes[key] = value
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package pipeline
+
+import "sync/atomic"
+
+// Totals over the lifetime of the extension process
+type Stats struct {
+	DroppedRecords atomic.Int64
+	DroppedBytes   atomic.Int64
+}
+
+type StatsSnapshot struct {
+	DroppedRecords int64 `json:"droppedRecords"`
+	DroppedBytes   int64 `json:"droppedBytes"`
+	// Events the extension's own queue discarded, set by the caller
+	QueueDropped int64 `json:"queueDropped"`
+}
+
+func (s *Stats) Snapshot() StatsSnapshot {
+	return StatsSnapshot{
+		DroppedRecords: s.DroppedRecords.Load(),
+		DroppedBytes:   s.DroppedBytes.Load(),
+	}
+}
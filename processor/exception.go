@@ -0,0 +1,229 @@
+package processor
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A single call site of a stack trace
+type Frame struct {
+	Function string `json:"function,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+}
+
+// An exception extracted from an error record
+type Exception struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	// Innermost call first
+	Frames []Frame `json:"frames,omitempty"`
+}
+
+var (
+	// Line prefix of the Node.js text format: timestamp, requestId and level
+	textPrefixPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T[^\t]+\t[^\t]*\t[A-Z]+\t`)
+	// Line prefix of the Python text format: [LEVEL], optionally followed by timestamp and requestId
+	pythonPrefixPattern = regexp.MustCompile(`^\[[A-Z]+\]\s+(?:\d{4}-\d{2}-\d{2}T\S+\s+\S+\s+)?`)
+	// "TypeError: message" or "java.lang.IllegalStateException: message"
+	exceptionHeadPattern = regexp.MustCompile(`^((?:[A-Za-z_$][\w$.]*)?(?:Error|Exception|Exit|Interrupt|Fault)):\s?(.*)$`)
+	// "panic: message" of an unrecovered Go panic
+	goPanicPattern = regexp.MustCompile(`^panic: (.*?)(?: \[recovered\])?$`)
+
+	// "    at fn (/var/task/index.js:10:5)"
+	nodeFramePattern = regexp.MustCompile(`^\s+at (?:(?:async )?(.+?) \()?(.+?):(\d+):(\d+)\)?$`)
+	// `  File "/var/task/app.py", line 10, in handler`
+	pythonFramePattern = regexp.MustCompile(`^\s*File "(.+)", line (\d+), in (.+)$`)
+	// "	at com.example.Handler.handle(Handler.java:42)", without "at" in the Lambda error object
+	javaFramePattern = regexp.MustCompile(`^\s*(?:at )?(?:[\w$.@-]+/)*((?:[\w$]+[./])+[<>\w$]+)\((?:([\w$-]+\.(?:java|kt|scala|groovy|clj))(?::(\d+))?|Native Method|Unknown Source)\)$`)
+	// "main.handler(...)" followed by "	/var/task/main.go:12 +0x1d"
+	goFunctionPattern = regexp.MustCompile(`^(?:created by )?(\S+?)(?:\([^()]*\))?(?: in goroutine \d+)?$`)
+	goFilePattern     = regexp.MustCompile(`^\s+(\S+\.go):(\d+)(?: \+0x[0-9a-f]+)?$`)
+)
+
+// The error object the Lambda runtimes log for uncaught errors
+type lambdaError struct {
+	ErrorType    string          `json:"errorType"`
+	ErrorMessage string          `json:"errorMessage"`
+	Stack        json.RawMessage `json:"stack"`
+	StackTrace   json.RawMessage `json:"stackTrace"`
+}
+
+// Frame of the Go runtime's error object
+type goLambdaFrame struct {
+	Path  string `json:"path"`
+	Line  int    `json:"line"`
+	Label string `json:"label"`
+}
+
+// Extracts the exception type, message and frames from an error record. Stack traces of
+// the Node, Python, Java and Go runtimes are recognized, both as printed and inside the
+// error object the runtimes log. Returns nil when the record doesn't look like an exception.
+func ParseException(message string) *Exception {
+	message = textPrefixPattern.ReplaceAllString(message, "")
+	message = pythonPrefixPattern.ReplaceAllString(message, "")
+
+	if start := strings.Index(message, `{"errorType"`); start >= 0 {
+		if exception := parseLambdaError(message[start:]); exception != nil {
+			return exception
+		}
+	}
+	if start := strings.Index(message, `{"errorMessage"`); start >= 0 {
+		if exception := parseLambdaError(message[start:]); exception != nil {
+			return exception
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	if exception := parseTraceback(lines); exception != nil {
+		return exception
+	}
+	first := strings.TrimSpace(lines[0])
+	if head := goPanicPattern.FindStringSubmatch(first); head != nil {
+		return &Exception{
+			Type:    "panic",
+			Message: head[1],
+			Frames:  parseFrames(lines[1:]),
+		}
+	}
+	head := exceptionHeadPattern.FindStringSubmatch(first)
+	if head == nil {
+		return nil
+	}
+	return &Exception{
+		Type:    head[1],
+		Message: head[2],
+		Frames:  parseFrames(lines[1:]),
+	}
+}
+
+// Python prints the exception after the frames, which are listed outermost first
+func parseTraceback(lines []string) *Exception {
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "Traceback (most recent call last):") {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+	for i := len(lines) - 1; i > start; i-- {
+		head := exceptionHeadPattern.FindStringSubmatch(strings.TrimSpace(lines[i]))
+		if head == nil {
+			continue
+		}
+		return &Exception{
+			Type:    head[1],
+			Message: head[2],
+			Frames:  parseFrames(lines[start+1 : i]),
+		}
+	}
+	// The head line is missing, e.g. "[ERROR] KeyError: 'id'" was logged first
+	if head := exceptionHeadPattern.FindStringSubmatch(strings.TrimSpace(lines[0])); head != nil && start > 0 {
+		return &Exception{
+			Type:    head[1],
+			Message: head[2],
+			Frames:  parseFrames(lines[start+1:]),
+		}
+	}
+	return nil
+}
+
+func parseLambdaError(raw string) *Exception {
+	var record lambdaError
+	if err := json.NewDecoder(strings.NewReader(raw)).Decode(&record); err != nil || record.ErrorType == "" {
+		return nil
+	}
+	exception := &Exception{
+		Type:    record.ErrorType,
+		Message: record.ErrorMessage,
+	}
+	stack := record.Stack
+	if len(stack) == 0 {
+		stack = record.StackTrace
+	}
+	var goFrames []goLambdaFrame
+	if json.Unmarshal(stack, &goFrames) == nil && len(goFrames) > 0 && goFrames[0].Path != "" {
+		for _, frame := range goFrames {
+			exception.Frames = append(exception.Frames, Frame{Function: frame.Label, File: frame.Path, Line: frame.Line})
+		}
+		return exception
+	}
+	var entries []string
+	if json.Unmarshal(stack, &entries) != nil {
+		var joined string
+		if json.Unmarshal(stack, &joined) == nil {
+			entries = []string{joined}
+		}
+	}
+	// Python entries span several lines, the frame and its source
+	lines := []string{}
+	for _, entry := range entries {
+		lines = append(lines, strings.Split(entry, "\n")...)
+	}
+	exception.Frames = parseFrames(lines)
+	return exception
+}
+
+// Parses the frames of any supported runtime, returning them innermost first
+func parseFrames(lines []string) []Frame {
+	frames := []Frame{}
+	outermostFirst := false
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		if match := nodeFramePattern.FindStringSubmatch(line); match != nil {
+			lineNumber, _ := strconv.Atoi(match[3])
+			column, _ := strconv.Atoi(match[4])
+			frames = append(frames, Frame{
+				Function: match[1],
+				File:     match[2],
+				Line:     lineNumber,
+				Column:   column,
+			})
+			continue
+		}
+		if match := pythonFramePattern.FindStringSubmatch(line); match != nil {
+			lineNumber, _ := strconv.Atoi(match[2])
+			frames = append(frames, Frame{
+				Function: match[3],
+				File:     match[1],
+				Line:     lineNumber,
+			})
+			outermostFirst = true
+			continue
+		}
+		if match := javaFramePattern.FindStringSubmatch(line); match != nil {
+			lineNumber, _ := strconv.Atoi(match[3])
+			frames = append(frames, Frame{
+				Function: match[1],
+				File:     match[2],
+				Line:     lineNumber,
+			})
+			continue
+		}
+		if i+1 < len(lines) {
+			function := goFunctionPattern.FindStringSubmatch(line)
+			file := goFilePattern.FindStringSubmatch(lines[i+1])
+			if function != nil && file != nil {
+				lineNumber, _ := strconv.Atoi(file[2])
+				frames = append(frames, Frame{
+					Function: function[1],
+					File:     file[1],
+					Line:     lineNumber,
+				})
+				i++
+			}
+		}
+	}
+	if outermostFirst {
+		for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+			frames[i], frames[j] = frames[j], frames[i]
+		}
+	}
+	return frames
+}
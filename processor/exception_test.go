@@ -0,0 +1,165 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseException(t *testing.T) {
+	cases := []struct {
+		name    string
+		message string
+		want    *Exception
+	}{
+		{
+			"node invoke error",
+			"2024-03-05T10:15:02.315Z\t6d68ca91-49c9-448d-89b8-7ca3e6dc66aa\tERROR\tInvoke Error \t" +
+				`{"errorType":"TypeError","errorMessage":"Cannot read properties of undefined (reading 'id')","stack":["TypeError: Cannot read properties of undefined (reading 'id')","    at getUser (/var/task/index.js:12:24)","    at Runtime.handler (/var/task/index.js:5:10)","    at Runtime.handleOnceNonStreaming (file:///var/runtime/index.mjs:1173:29)"]}`,
+			&Exception{
+				Type:    "TypeError",
+				Message: "Cannot read properties of undefined (reading 'id')",
+				Frames: []Frame{
+					{Function: "getUser", File: "/var/task/index.js", Line: 12, Column: 24},
+					{Function: "Runtime.handler", File: "/var/task/index.js", Line: 5, Column: 10},
+					{Function: "Runtime.handleOnceNonStreaming", File: "file:///var/runtime/index.mjs", Line: 1173, Column: 29},
+				},
+			},
+		},
+		{
+			"node printed stack",
+			"TypeError: Cannot read properties of undefined (reading 'id')\n" +
+				"    at getUser (/var/task/index.js:12:24)\n" +
+				"    at async Runtime.handler (/var/task/index.js:5:10)\n" +
+				"    at /var/task/index.js:30:1",
+			&Exception{
+				Type:    "TypeError",
+				Message: "Cannot read properties of undefined (reading 'id')",
+				Frames: []Frame{
+					{Function: "getUser", File: "/var/task/index.js", Line: 12, Column: 24},
+					{Function: "Runtime.handler", File: "/var/task/index.js", Line: 5, Column: 10},
+					{File: "/var/task/index.js", Line: 30, Column: 1},
+				},
+			},
+		},
+		{
+			"python traceback",
+			"Traceback (most recent call last):\n" +
+				"  File \"/var/task/app.py\", line 10, in handler\n" +
+				"    return get_user(event)\n" +
+				"  File \"/var/task/app.py\", line 4, in get_user\n" +
+				"    return event[\"id\"]\n" +
+				"KeyError: 'id'",
+			&Exception{
+				Type:    "KeyError",
+				Message: "'id'",
+				Frames: []Frame{
+					{Function: "get_user", File: "/var/task/app.py", Line: 4},
+					{Function: "handler", File: "/var/task/app.py", Line: 10},
+				},
+			},
+		},
+		{
+			"python runtime error",
+			"[ERROR] KeyError: 'id'\n" +
+				"Traceback (most recent call last):\n" +
+				"  File \"/var/task/app.py\", line 10, in handler\n" +
+				"    return get_user(event)\n" +
+				"  File \"/var/task/app.py\", line 4, in get_user\n" +
+				"    return event[\"id\"]",
+			&Exception{
+				Type:    "KeyError",
+				Message: "'id'",
+				Frames: []Frame{
+					{Function: "get_user", File: "/var/task/app.py", Line: 4},
+					{Function: "handler", File: "/var/task/app.py", Line: 10},
+				},
+			},
+		},
+		{
+			"python error object",
+			`{"errorMessage": "'id'", "errorType": "KeyError", "requestId": "6d68ca91-49c9-448d-89b8-7ca3e6dc66aa", "stackTrace": ["  File \"/var/task/app.py\", line 10, in handler\n    return get_user(event)\n", "  File \"/var/task/app.py\", line 4, in get_user\n    return event[\"id\"]\n"]}`,
+			&Exception{
+				Type:    "KeyError",
+				Message: "'id'",
+				Frames: []Frame{
+					{Function: "get_user", File: "/var/task/app.py", Line: 4},
+					{Function: "handler", File: "/var/task/app.py", Line: 10},
+				},
+			},
+		},
+		{
+			"java printed stack",
+			"java.lang.IllegalStateException: order 42 is closed\n" +
+				"\tat com.example.orders.OrderService.charge(OrderService.java:57)\n" +
+				"\tat com.example.orders.Handler.handleRequest(Handler.java:23)\n" +
+				"\tat java.base/jdk.internal.reflect.NativeMethodAccessorImpl.invoke0(Native Method)",
+			&Exception{
+				Type:    "java.lang.IllegalStateException",
+				Message: "order 42 is closed",
+				Frames: []Frame{
+					{Function: "com.example.orders.OrderService.charge", File: "OrderService.java", Line: 57},
+					{Function: "com.example.orders.Handler.handleRequest", File: "Handler.java", Line: 23},
+					{Function: "jdk.internal.reflect.NativeMethodAccessorImpl.invoke0"},
+				},
+			},
+		},
+		{
+			"java error object",
+			`{"errorMessage":"order 42 is closed","errorType":"java.lang.IllegalStateException","stackTrace":["com.example.orders.OrderService.charge(OrderService.java:57)","com.example.orders.Handler.handleRequest(Handler.java:23)"]}`,
+			&Exception{
+				Type:    "java.lang.IllegalStateException",
+				Message: "order 42 is closed",
+				Frames: []Frame{
+					{Function: "com.example.orders.OrderService.charge", File: "OrderService.java", Line: 57},
+					{Function: "com.example.orders.Handler.handleRequest", File: "Handler.java", Line: 23},
+				},
+			},
+		},
+		{
+			"go panic",
+			"panic: runtime error: invalid memory address or nil pointer dereference\n" +
+				"[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x4b1f2a]\n" +
+				"\n" +
+				"goroutine 1 [running]:\n" +
+				"main.getUser(...)\n" +
+				"\t/var/task/main.go:21\n" +
+				"main.handler({0x0, 0x0}, {0xc00001c0f0, 0x20})\n" +
+				"\t/var/task/main.go:14 +0x2a\n" +
+				"github.com/aws/aws-lambda-go/lambda.(*handlerOptions).Invoke(0xc000012345, {0x0, 0x0})\n" +
+				"\t/go/pkg/mod/github.com/aws/aws-lambda-go@v1.41.0/lambda/handler.go:253 +0x1d",
+			&Exception{
+				Type:    "panic",
+				Message: "runtime error: invalid memory address or nil pointer dereference",
+				Frames: []Frame{
+					{Function: "main.getUser", File: "/var/task/main.go", Line: 21},
+					{Function: "main.handler", File: "/var/task/main.go", Line: 14},
+					{Function: "github.com/aws/aws-lambda-go/lambda.(*handlerOptions).Invoke", File: "/go/pkg/mod/github.com/aws/aws-lambda-go@v1.41.0/lambda/handler.go", Line: 253},
+				},
+			},
+		},
+		{
+			"go error object",
+			`{"errorMessage":"order not found","errorType":"errorString","stackTrace":[{"path":"/var/task/main.go","line":21,"label":"getUser"},{"path":"/var/task/main.go","line":14,"label":"handler"}]}`,
+			&Exception{
+				Type:    "errorString",
+				Message: "order not found",
+				Frames: []Frame{
+					{Function: "getUser", File: "/var/task/main.go", Line: 21},
+					{Function: "handler", File: "/var/task/main.go", Line: 14},
+				},
+			},
+		},
+		{
+			"not an exception",
+			"2024-03-05T10:15:02.315Z\t6d68ca91-49c9-448d-89b8-7ca3e6dc66aa\tINFO\tcharged order 42",
+			nil,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ParseException(c.message); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("ParseException =\n%+v\nwant\n%+v", got, c.want)
+			}
+		})
+	}
+}
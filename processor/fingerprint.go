@@ -0,0 +1,117 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// Number of stack frames that contribute to a fingerprint
+const fingerprintFrames = 5
+
+var (
+	// Lines of the stack trace formats emitted by the Node, Python, Java and Go runtimes
+	framePattern = regexp.MustCompile(`^\s+(at |File ")|^\s+\S+\.go:\d+|^\S+\(.*\)$`)
+	// Markers of an error in the first line of a message
+	errorPattern = regexp.MustCompile(`(?i)\b(error|exception|panic|traceback|fatal)\b`)
+
+	uuidPattern    = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	hexPattern     = regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b|\b[0-9a-f]{16,}\b`)
+	quotedPattern  = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+	numberPattern  = regexp.MustCompile(`\d+`)
+	locationSuffix = regexp.MustCompile(`(:\d+)+\)?$|, line \d+|\s\+0x[0-9a-f]+$`)
+)
+
+// Reports whether a line is an error record that should be fingerprinted
+func IsError(message string, level Level) bool {
+	if level >= LevelError {
+		return true
+	}
+	if level != LevelUnknown {
+		return false
+	}
+	first, _, _ := strings.Cut(message, "\n")
+	return mayBeError(first) && errorPattern.MatchString(first)
+}
+
+// Cheap check for the keywords of errorPattern, so most lines skip the regex
+func mayBeError(line string) bool {
+	for _, keyword := range errorKeywords {
+		if containsFold(line, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+var errorKeywords = []string{"error", "exception", "panic", "traceback", "fatal"}
+
+// Case-insensitive strings.Contains for a lowercase ASCII needle, without allocating
+func containsFold(s, needle string) bool {
+	for i := 0; i+len(needle) <= len(s); i++ {
+		match := true
+		for j := 0; j < len(needle); j++ {
+			c := s[i+j]
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			if c != needle[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// Computes a stable grouping key for an error.
+//
+// The key is derived from the message template, with ids, numbers and quoted values
+// stripped, and the top stack frames with their line and column numbers removed, so the
+// same error raised with different inputs or from a rebuilt bundle groups together.
+// When the stack trace can be parsed the exception type and frame functions are used
+// instead of the raw lines.
+func Fingerprint(message string) string {
+	if exception := ParseException(message); exception != nil && len(exception.Frames) > 0 {
+		parts := []string{exception.Type, Template(exception.Message)}
+		for _, frame := range exception.Frames[:min(len(exception.Frames), fingerprintFrames)] {
+			parts = append(parts, frame.Function+" "+frame.File)
+		}
+		return digest(parts)
+	}
+
+	lines := strings.Split(message, "\n")
+	parts := []string{Template(lines[0])}
+	for _, line := range lines[1:] {
+		if len(parts) > fingerprintFrames {
+			break
+		}
+		if !framePattern.MatchString(line) {
+			continue
+		}
+		parts = append(parts, normalizeFrame(line))
+	}
+	return digest(parts)
+}
+
+func digest(parts []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Reduces an error message to its template by replacing variable parts with placeholders
+func Template(message string) string {
+	message = uuidPattern.ReplaceAllString(message, "<uuid>")
+	message = hexPattern.ReplaceAllString(message, "<hex>")
+	message = quotedPattern.ReplaceAllString(message, "<str>")
+	message = numberPattern.ReplaceAllString(message, "<n>")
+	return strings.TrimSpace(message)
+}
+
+func normalizeFrame(frame string) string {
+	return locationSuffix.ReplaceAllString(strings.TrimSpace(frame), "")
+}
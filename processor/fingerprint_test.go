@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"testing"
+)
+
+func TestFingerprintIgnoresVariableParts(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+	}{
+		{
+			"ids and numbers",
+			"Error: user 1234 not found in request 6d68ca91-49c9-448d-89b8-7ca3e6dc66aa\n    at getUser (/var/task/index.js:12:24)\n    at Runtime.handler (/var/task/index.js:5:10)",
+			"Error: user 98 not found in request 0b7e2c4a-1f3d-4e5a-9b8c-7d6e5f4a3b2c\n    at getUser (/var/task/index.js:12:24)\n    at Runtime.handler (/var/task/index.js:5:10)",
+		},
+		{
+			"quoted values and hex",
+			`Error: table "orders" rejected item 0x7ffd3a2c`,
+			`Error: table "users" rejected item 0x1b`,
+		},
+		{
+			"line numbers of a rebuilt bundle",
+			"TypeError: x is not a function\n    at charge (/var/task/index.mjs:120:7)\n    at Runtime.handler (/var/task/index.mjs:80:3)",
+			"TypeError: x is not a function\n    at charge (/var/task/index.mjs:131:9)\n    at Runtime.handler (/var/task/index.mjs:84:3)",
+		},
+		{
+			"unparsed lines",
+			"ERROR request 42 failed after 3 attempts",
+			"ERROR request 7 failed after 5 attempts",
+		},
+		{
+			"python line numbers",
+			"Traceback (most recent call last):\n  File \"/var/task/app.py\", line 10, in handler\n    return get_user(event)\nKeyError: 'id'",
+			"Traceback (most recent call last):\n  File \"/var/task/app.py\", line 14, in handler\n    return get_user(event)\nKeyError: 'name'",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if a, b := Fingerprint(c.a), Fingerprint(c.b); a != b {
+				t.Errorf("fingerprints differ: %s and %s", a, b)
+			}
+		})
+	}
+}
+
+func TestFingerprintSeparatesErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+	}{
+		{
+			"different stacks",
+			"Error: user 1234 not found\n    at getUser (/var/task/index.js:12:24)\n    at Runtime.handler (/var/task/index.js:5:10)",
+			"Error: user 1234 not found\n    at getAccount (/var/task/account.js:12:24)\n    at Runtime.handler (/var/task/index.js:5:10)",
+		},
+		{
+			"different types",
+			"TypeError: bad input\n    at Runtime.handler (/var/task/index.js:5:10)",
+			"RangeError: bad input\n    at Runtime.handler (/var/task/index.js:5:10)",
+		},
+		{
+			"different messages",
+			"Error: user not found\n    at Runtime.handler (/var/task/index.js:5:10)",
+			"Error: order not found\n    at Runtime.handler (/var/task/index.js:5:10)",
+		},
+		{
+			"different unparsed lines",
+			"ERROR connection refused",
+			"ERROR connection reset",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if a, b := Fingerprint(c.a), Fingerprint(c.b); a == b {
+				t.Errorf("fingerprints match: %s", a)
+			}
+		})
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	cases := []struct {
+		message string
+		want    string
+	}{
+		{"user 1234 not found", "user <n> not found"},
+		{"request 6d68ca91-49c9-448d-89b8-7ca3e6dc66aa failed", "request <uuid> failed"},
+		{"address 0x7ffd3a2c", "address <hex>"},
+		{`key "orders/42" missing`, "key <str> missing"},
+		{"  trimmed  ", "trimmed"},
+	}
+	for _, c := range cases {
+		if got := Template(c.message); got != c.want {
+			t.Errorf("Template(%q) = %q, want %q", c.message, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package processor
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Severity of a function log line, ordered from least to most severe
+type Level int
+
+const (
+	// The line carries no recognizable level and is never filtered
+	LevelUnknown Level = iota
+	LevelTrace
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+var levelNames = map[Level]string{
+	LevelTrace: "TRACE",
+	LevelDebug: "DEBUG",
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
+	LevelFatal: "FATAL",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// Parses a level name as used by AWS_LAMBDA_LOG_LEVEL and the common logging libraries
+func ParseLevel(name string) Level {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "TRACE":
+		return LevelTrace
+	case "DEBUG":
+		return LevelDebug
+	case "INFO":
+		return LevelInfo
+	case "WARN", "WARNING":
+		return LevelWarn
+	case "ERROR":
+		return LevelError
+	case "FATAL", "CRITICAL":
+		return LevelFatal
+	}
+	return LevelUnknown
+}
+
+// The format function logs are written in, mirroring AWS_LAMBDA_LOG_FORMAT
+type LogFormat string
+
+const (
+	FormatText LogFormat = "Text"
+	FormatJSON LogFormat = "JSON"
+)
+
+// Detects the level of a function log line in the shape the Lambda runtimes emit it.
+//
+// For the JSON format the `level` field of the record is used. For the text format the
+// Node.js layout (timestamp, requestId, level, message separated by tabs), the Python
+// layout ([LEVEL] prefix), a LEVEL: prefix and JSON records written by structured loggers
+// are recognized.
+func DetectLevel(line string, format LogFormat) Level {
+	if format == FormatJSON || strings.HasPrefix(line, "{") {
+		var record struct {
+			Level string `json:"level"`
+		}
+		if json.Unmarshal([]byte(line), &record) == nil {
+			return ParseLevel(record.Level)
+		}
+		return LevelUnknown
+	}
+
+	if strings.HasPrefix(line, "[") {
+		if end := strings.IndexByte(line, ']'); end > 0 {
+			return ParseLevel(line[1:end])
+		}
+	}
+	// Level names are at most 8 letters, e.g. WARNING: or CRITICAL:
+	if end := strings.IndexByte(line, ':'); end > 0 && end <= 8 {
+		if level := ParseLevel(line[:end]); level != LevelUnknown {
+			return level
+		}
+	}
+	columns := strings.SplitN(line, "\t", 4)
+	if len(columns) == 4 {
+		return ParseLevel(columns[2])
+	}
+	return LevelUnknown
+}
+
+// Drops function log lines below a minimum level
+type LevelFilter struct {
+	Min    Level
+	Format LogFormat
+}
+
+// Reports whether the line should be forwarded. Lines without a recognizable level are kept.
+func (f *LevelFilter) Keep(line string) bool {
+	if f.Min == LevelUnknown {
+		return true
+	}
+	level := DetectLevel(line, f.Format)
+	return level == LevelUnknown || level >= f.Min
+}
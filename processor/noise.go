@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// A named set of patterns matching log lines that are rarely worth forwarding
+type NoisePreset struct {
+	Name        string
+	Description string
+	patterns    []*regexp.Regexp
+}
+
+// Built-in presets, selectable by name
+var NoisePresets = []NoisePreset{
+	{
+		Name:        "aws-sdk-retry",
+		Description: "Retry warnings logged by the AWS SDKs for throttled or transient failures",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)\bretrying (the )?request\b`),
+			regexp.MustCompile(`Retry needed, retrying request after delay`),
+			regexp.MustCompile(`botocore\.retryhandler`),
+			regexp.MustCompile(`(?i)\bretry attempt \d+`),
+		},
+	},
+	{
+		Name:        "nextjs-banner",
+		Description: "Startup banner printed by Next.js standalone servers on every cold start",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?m)^\s*▲ Next\.js \d`),
+			regexp.MustCompile(`(?m)^\s*[-✓] (Local|Network|Environments):`),
+			regexp.MustCompile(`(?m)^\s*✓ (Ready in \d|Starting\.\.\.)`),
+		},
+	},
+	{
+		Name:        "python-warnings",
+		Description: "Output of Python's warnings module, e.g. DeprecationWarning with its source line",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?m)^\S+\.py:\d+: \w*Warning: `),
+			regexp.MustCompile(`(?m)^\s+warnings\.warn\(`),
+		},
+	},
+	{
+		Name:        "node-warnings",
+		Description: "Process warnings emitted by Node.js, e.g. deprecations and experimental features",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`\(node:\d+\) (\[\w+\] )?\w*Warning: `),
+			regexp.MustCompile("\\(Use `node --trace-(warnings|deprecation) \\.\\.\\.`"),
+		},
+	},
+}
+
+// Drops function log lines matching any of the selected presets
+type NoiseFilter struct {
+	patterns []*regexp.Regexp
+}
+
+// Builds a filter from preset names, failing on unknown ones
+func NewNoiseFilter(names []string) (*NoiseFilter, error) {
+	filter := &NoiseFilter{}
+	for _, name := range names {
+		found := false
+		for _, preset := range NoisePresets {
+			if preset.Name == name {
+				filter.patterns = append(filter.patterns, preset.patterns...)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown noise preset %q", name)
+		}
+	}
+	return filter, nil
+}
+
+// Reports whether the line should be forwarded
+func (f *NoiseFilter) Keep(line string) bool {
+	if len(f.patterns) == 0 {
+		return true
+	}
+	message := textPrefixPattern.ReplaceAllString(line, "")
+	for _, pattern := range f.patterns {
+		if pattern.MatchString(message) {
+			return false
+		}
+	}
+	return true
+}
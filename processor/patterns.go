@@ -0,0 +1,54 @@
+package processor
+
+import (
+	"regexp"
+)
+
+// Keeps the function log lines matching any include pattern, if there are any, and none
+// of the exclude patterns. Patterns match the message, without the runtime's text prefix.
+type PatternFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// Compiles the include and exclude patterns, failing on the first invalid one
+func NewPatternFilter(include []string, exclude []string) (*PatternFilter, error) {
+	filter := &PatternFilter{}
+	for _, pattern := range include {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.include = append(filter.include, compiled)
+	}
+	for _, pattern := range exclude {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.exclude = append(filter.exclude, compiled)
+	}
+	return filter, nil
+}
+
+// Reports whether the line should be forwarded
+func (f *PatternFilter) Keep(line string) bool {
+	if len(f.include) == 0 && len(f.exclude) == 0 {
+		return true
+	}
+	message := textPrefixPattern.ReplaceAllString(line, "")
+	for _, pattern := range f.exclude {
+		if pattern.MatchString(message) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pattern := range f.include {
+		if pattern.MatchString(message) {
+			return true
+		}
+	}
+	return false
+}
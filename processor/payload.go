@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// What the Runtime API proxy learned from an invocation's payload
+type Payload struct {
+	// Hex encoded SHA-256 of the payload, set when hashing is enabled. Identical hashes
+	// across request ids point at duplicate deliveries.
+	Hash      string
+	Execution *Execution
+}
+
+// Extracts the details attached to the invocation's records from its payload
+func InspectPayload(payload []byte, hash bool) *Payload {
+	inspected := &Payload{Execution: ParseExecution(payload)}
+	if hash {
+		sum := sha256.Sum256(payload)
+		inspected.Hash = hex.EncodeToString(sum[:])
+	}
+	return inspected
+}
+
+// Payloads seen by the Runtime API proxy, waiting for their invocation to be flushed
+type Payloads struct {
+	mu        sync.Mutex
+	byRequest map[string]*Payload
+}
+
+func NewPayloads() *Payloads {
+	return &Payloads{byRequest: map[string]*Payload{}}
+}
+
+func (p *Payloads) Put(requestID string, payload *Payload) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.byRequest[requestID] = payload
+}
+
+// Returns and forgets the payload of the request, an empty one when it wasn't proxied
+func (p *Payloads) Take(requestID string) *Payload {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	payload, ok := p.byRequest[requestID]
+	if !ok {
+		return &Payload{}
+	}
+	delete(p.byRequest, requestID)
+	return payload
+}
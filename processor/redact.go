@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// A named pattern matching sensitive values that should never leave the function. When
+// it has a group named secret, only that part of a match is masked.
+type RedactionPreset struct {
+	Name        string
+	Description string
+	pattern     *regexp.Regexp
+	// Confirms a match, for patterns too broad on their own
+	valid func(match string) bool
+}
+
+// Built-in presets, selectable by name
+var RedactionPresets = []RedactionPreset{
+	{
+		Name:        "email",
+		Description: "Email addresses",
+		pattern:     regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	{
+		Name:        "credit-card",
+		Description: "Payment card numbers of 13 to 19 digits, optionally grouped by spaces or dashes, that pass the Luhn check",
+		pattern:     regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		valid:       luhn,
+	},
+	{
+		Name:        "aws-key",
+		Description: "AWS access key IDs and the secret access keys assigned next to them",
+		pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b|(?i:aws_?secret_?access_?key["']?\s*[:=]\s*["']?)(?P<secret>[A-Za-z0-9/+=]{40})`),
+	},
+	{
+		Name:        "bearer-token",
+		Description: "Bearer tokens of authorization headers and JWTs",
+		pattern:     regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]+=*|\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+	},
+}
+
+// Replaces the matches of the selected presets and custom patterns with a mask
+type Redactor struct {
+	presets  []RedactionPreset
+	patterns []*regexp.Regexp
+	mask     string
+}
+
+// Builds a redactor from preset names and custom patterns, failing on unknown presets and
+// invalid patterns
+func NewRedactor(names []string, patterns []string, mask string) (*Redactor, error) {
+	redactor := &Redactor{mask: mask}
+	for _, name := range names {
+		found := false
+		for _, preset := range RedactionPresets {
+			if preset.Name == name {
+				redactor.presets = append(redactor.presets, preset)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown redaction preset %q", name)
+		}
+	}
+	for _, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		redactor.patterns = append(redactor.patterns, compiled)
+	}
+	return redactor, nil
+}
+
+// Returns the line with every sensitive value masked. A nil redactor returns it as it is.
+func (r *Redactor) Redact(line string) string {
+	if r == nil {
+		return line
+	}
+	for _, preset := range r.presets {
+		line = preset.pattern.ReplaceAllStringFunc(line, func(match string) string {
+			if preset.valid != nil && !preset.valid(match) {
+				return match
+			}
+			if i := preset.pattern.SubexpIndex("secret"); i >= 0 {
+				if at := preset.pattern.FindStringSubmatchIndex(match); at[2*i] >= 0 {
+					return match[:at[2*i]] + r.mask + match[at[2*i+1]:]
+				}
+			}
+			return r.mask
+		})
+	}
+	for _, pattern := range r.patterns {
+		line = pattern.ReplaceAllLiteralString(line, r.mask)
+	}
+	return line
+}
+
+// Reports whether the digits of a card number pass the Luhn check, ignoring separators
+func luhn(number string) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return sum%10 == 0
+}
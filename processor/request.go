@@ -0,0 +1,59 @@
+package processor
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Detects the requestId a function log line was written under, empty if it carries none.
+//
+// For the JSON format the `requestId` field of the record is used. For the text format the
+// Node.js layout (timestamp, requestId, level, message) and the Python layout ([LEVEL],
+// timestamp, requestId, message) are recognized.
+func DetectRequestID(line string, format LogFormat) string {
+	if format == FormatJSON {
+		if !strings.Contains(line, `"requestId"`) {
+			return ""
+		}
+		var record struct {
+			RequestID string `json:"requestId"`
+		}
+		if json.Unmarshal([]byte(line), &record) == nil && isRequestID(record.RequestID) {
+			return record.RequestID
+		}
+		return ""
+	}
+
+	columns := strings.SplitN(line, "\t", 4)
+	if len(columns) < 4 {
+		return ""
+	}
+	column := columns[1]
+	if strings.HasPrefix(line, "[") {
+		column = columns[2]
+	}
+	if isRequestID(column) {
+		return column
+	}
+	return ""
+}
+
+// Request IDs are UUIDs in their canonical 8-4-4-4-12 form
+func isRequestID(value string) bool {
+	if len(value) != 36 {
+		return false
+	}
+	for i, c := range value {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
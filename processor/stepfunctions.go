@@ -0,0 +1,62 @@
+package processor
+
+import "encoding/json"
+
+// Step Functions execution an invocation belongs to, taken from the context object
+// ($$) the state machine passes in its payload
+type Execution struct {
+	ExecutionArn    string `json:"executionArn"`
+	StateName       string `json:"stateName,omitempty"`
+	StateMachineArn string `json:"stateMachineArn,omitempty"`
+}
+
+type contextObject struct {
+	Execution struct {
+		ID string `json:"Id"`
+	} `json:"Execution"`
+	State struct {
+		Name string `json:"Name"`
+	} `json:"State"`
+	StateMachine struct {
+		ID string `json:"Id"`
+	} `json:"StateMachine"`
+}
+
+// Keys the context object is commonly passed under, e.g. "context.$": "$$"
+var contextKeys = []string{"context", "Context", "sfn"}
+
+// Looks for a Step Functions context object at the root of the payload or under one
+// of the common keys. Returns nil for payloads of other event sources.
+func ParseExecution(payload []byte) *Execution {
+	var root map[string]json.RawMessage
+	if json.Unmarshal(payload, &root) != nil {
+		return nil
+	}
+	candidates := []json.RawMessage{payload}
+	for _, key := range contextKeys {
+		if raw, ok := root[key]; ok {
+			candidates = append(candidates, raw)
+		}
+	}
+	for _, raw := range candidates {
+		var object contextObject
+		if json.Unmarshal(raw, &object) != nil || object.Execution.ID == "" {
+			continue
+		}
+		return &Execution{
+			ExecutionArn:    object.Execution.ID,
+			StateName:       object.State.Name,
+			StateMachineArn: object.StateMachine.ID,
+		}
+	}
+	return nil
+}
+
+// Attributes attached to every record of the invocation
+func (e *Execution) Attributes() map[string]string {
+	attributes := map[string]string{"stepFunctions.executionArn": e.ExecutionArn}
+	if e.StateName != "" {
+		attributes["stepFunctions.stateName"] = e.StateName
+	}
+	return attributes
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+)
+
+const nextPath = "/2018-06-01/runtime/invocation/next"
+
+// Sits between the runtime and the Runtime API so the extension can see invocation
+// payloads, which the Extensions API never exposes. The runtime is pointed at it by
+// the sst-proxy exec wrapper; every other request is forwarded untouched.
+type Proxy struct {
+	address  string
+	upstream string
+	onInvoke func(requestID string, payload []byte)
+}
+
+// Creates a proxy listening on address, calling onInvoke with the payload of every invocation
+func New(address string, onInvoke func(requestID string, payload []byte)) *Proxy {
+	return &Proxy{
+		address:  address,
+		upstream: os.Getenv("AWS_LAMBDA_RUNTIME_API"),
+		onInvoke: onInvoke,
+	}
+}
+
+// Starts listening in a goroutine
+func (p *Proxy) Start() {
+	reverse := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: p.upstream})
+	reverse.ModifyResponse = func(res *http.Response) error {
+		if res.Request.URL.Path != nextPath || res.StatusCode != http.StatusOK {
+			return nil
+		}
+		payload, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		res.Body = io.NopCloser(bytes.NewReader(payload))
+		p.onInvoke(res.Header.Get("Lambda-Runtime-Aws-Request-Id"), payload)
+		return nil
+	}
+	go func() {
+		err := http.ListenAndServe(p.address, reverse)
+		if err != nil {
+			log.Println("[proxy:Start] Runtime API proxy stopped:", err)
+		}
+	}()
+}
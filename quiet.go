@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/sst/extension/api/extension"
+	"github.com/sst/extension/sink"
+)
+
+// Tagged log lines reporting a problem or a warning, e.g. a retry or dropped telemetry,
+// the only ones written in quiet mode
+var quietPattern = regexp.MustCompile(`\[[\w:]+\] (?i:.*\b(fail|failed|failure|error|exiting|unexpected|stopped|warn|warning|timeout|timed out|retry|retrying|dropped|dropping)\b)`)
+
+// Drops the extension's own log output except for errors and warnings. Everything the extension
+// writes lands in the function's log group.
+type quietWriter struct {
+	out io.Writer
+}
+
+func (w quietWriter) Write(p []byte) (int, error) {
+	if !quietPattern.Match(p) {
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
+
+// Writes the single structured line describing the extension after it initialized
+func logInit(registration *extension.RegisterResponse, consumers []string, spanSinks []sink.SpanSink, alerters int) {
+	names := append([]string{}, consumers...)
+	for _, s := range spanSinks {
+		names = append(names, sinkName(s))
+	}
+	line, _ := json.Marshal(map[string]interface{}{
+		"type":        "sst.extension.init",
+		"extensionId": registration.ExtensionID,
+		"accountId":   registration.AccountID,
+		"sinks":       names,
+		"alerters":    alerters,
+	})
+	fmt.Fprintln(os.Stderr, string(line))
+}
+
+func sinkName(s interface{}) string {
+	return strings.ToLower(strings.TrimPrefix(fmt.Sprintf("%T", s), "*sink."))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestQuietWriter(t *testing.T) {
+	cases := []struct {
+		line string
+		kept bool
+	}{
+		{"[main:deliver] Failed to write batch: ThrottlingException\n", true},
+		{"[listener:goroutine] Unexpected stop on Http Server: closed\n", true},
+		{"[main:logsDropped] Platform dropped 12 records: buffer full\n", true},
+		{"[wal:Append] Queue full, dropping the oldest batch\n", true},
+		{"[cloudwatch:Write] Warning: retrying PutLogEvents after throttling\n", true},
+		{"[grpc:Write] Retry 2 of the batch\n", true},
+		{"[main:appconfig] Poll timeout after 10s\n", true},
+		{"[listener:tcp] Timed out waiting for connections\n", true},
+		{"[cloudwatch:Write] Creating log group /aws/lambda/api\n", false},
+		{"[main:config] Reloaded settings\n", false},
+		{"flushing 12 lines, 0 filtered\n", false},
+		{"warning without a component tag\n", false},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		n, err := quietWriter{out: &out}.Write([]byte(c.line))
+		if err != nil || n != len(c.line) {
+			t.Errorf("Write(%q) = %d, %v", c.line, n, err)
+		}
+		if kept := out.Len() > 0; kept != c.kept {
+			t.Errorf("Write(%q) kept the line: %v, want %v", c.line, kept, c.kept)
+		}
+	}
+}
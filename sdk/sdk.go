@@ -0,0 +1,129 @@
+// Package sdk encodes the in-band actions the SST extension reads from a function's logs,
+// so Go functions don't have to hand-roll the protocol:
+//
+//	sdk.Emit(sdk.LogSplit("/sst/orders"), sdk.Tag("tenantId", tenant), sdk.Level("WARN"))
+//
+// Actions are written to stdout, which the Lambda runtime forwards to the extension.
+package sdk
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+// Default marker introducing an action, see SST_EXTENSION_ACTION_MARKERS
+const Marker = "::sst::"
+
+// One instruction to the extension
+type Action struct {
+	Action     string      `json:"action"`
+	Properties interface{} `json:"properties,omitempty"`
+}
+
+// Routes the invocation's lines from here on to a log group, or duplicates them to
+// several
+func LogSplit(groups ...string) Action {
+	var name interface{} = groups
+	if len(groups) == 1 {
+		name = groups[0]
+	}
+	return Action{Action: "log.split", Properties: map[string]interface{}{"logGroupName": name}}
+}
+
+// Overrides the log stream of the invocation's lines
+func LogStream(name string) Action {
+	return Action{Action: "log.stream", Properties: map[string]string{"logStreamName": name}}
+}
+
+// Sets the retention of the invocation's log group in days
+func LogRetention(days int) Action {
+	return Action{Action: "log.retention", Properties: map[string]int{"days": days}}
+}
+
+// Sets the minimum level of the invocation's forwarded lines, empty restores the configured one
+func Level(level string) Action {
+	return Action{Action: "log.level", Properties: map[string]string{"level": level}}
+}
+
+// Attaches a field to the invocation's entries
+func Tag(key string, value string) Action {
+	return Tags(map[string]string{key: value})
+}
+
+// Attaches several fields to the invocation's entries
+func Tags(fields map[string]string) Action {
+	return Action{Action: "log.tag", Properties: fields}
+}
+
+// Delivers what the invocation logged so far
+func Flush() Action {
+	return Action{Action: "log.flush"}
+}
+
+// Has the extension read its configuration again, e.g. after changing a configuration file
+func ReloadConfig() Action {
+	return Action{Action: "config.reload"}
+}
+
+// A metric put with metric.put, written as EMF by the extension
+type MetricData struct {
+	// Defaults to SST
+	Namespace string  `json:"namespace,omitempty"`
+	Name      string  `json:"name"`
+	Value     float64 `json:"value"`
+	// One of the CloudWatch units, e.g. Count or Milliseconds
+	Unit       string            `json:"unit,omitempty"`
+	Dimensions map[string]string `json:"dimensions,omitempty"`
+}
+
+// Puts a metric without a unit or dimensions
+func Metric(name string, value float64) Action {
+	return PutMetric(MetricData{Name: name, Value: value})
+}
+
+// Puts a metric
+func PutMetric(metric MetricData) Action {
+	return Action{Action: "metric.put", Properties: metric}
+}
+
+// Declares a span of the invocation's trace
+func Span(name string, start time.Time, end time.Time) Action {
+	return Action{Action: "trace.span", Properties: map[string]interface{}{
+		"name":  name,
+		"start": start.UTC().Format(time.RFC3339Nano),
+		"end":   end.UTC().Format(time.RFC3339Nano),
+	}}
+}
+
+// Encodes actions as a single log line, without the trailing newline
+func Line(actions ...Action) (string, error) {
+	var payload interface{} = actions
+	if len(actions) == 1 {
+		payload = actions[0]
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return Marker + string(encoded), nil
+}
+
+// Writes actions to w as one line
+func Write(w io.Writer, actions ...Action) error {
+	if len(actions) == 0 {
+		return nil
+	}
+	line, err := Line(actions...)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, line+"\n")
+	return err
+}
+
+// Writes actions to stdout as one line
+func Emit(actions ...Action) error {
+	return Write(os.Stdout, actions...)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/sst/extension/config"
+)
+
+// Limit on each lookup, they happen during init whose duration the function pays for
+const secretTimeout = 5 * time.Second
+
+// Resolves settings written as ssm:/path/to/parameter or secretsmanager:<arn or name>,
+// optionally followed by #key to pick a key of a JSON secret. Values are looked up once
+// when the configuration is first loaded and cached for the life of the process.
+type secretResolver struct {
+	once    sync.Once
+	ssm     *ssm.Client
+	secrets *secretsmanager.Client
+	mu      sync.Mutex
+	cache   map[string]string
+}
+
+func init() {
+	resolver := &secretResolver{cache: map[string]string{}}
+	config.RegisterResolver("ssm:", resolver.parameter)
+	config.RegisterResolver("secretsmanager:", resolver.secret)
+}
+
+// Reads a Parameter Store parameter, decrypting SecureStrings
+func (r *secretResolver) parameter(name string) (string, error) {
+	value, err := r.lookup("ssm:"+name, func(ctx context.Context) (string, error) {
+		out, err := r.ssm.GetParameter(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(name),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return "", err
+		}
+		return aws.ToString(out.Parameter.Value), nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("ssm:%s: %w", name, err)
+	}
+	return value, nil
+}
+
+// Reads a Secrets Manager secret, or one key of a JSON secret
+func (r *secretResolver) secret(reference string) (string, error) {
+	id, key, _ := strings.Cut(reference, "#")
+	secret, err := r.lookup("secretsmanager:"+id, func(ctx context.Context) (string, error) {
+		out, err := r.secrets.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(id),
+		})
+		if err != nil {
+			return "", err
+		}
+		return aws.ToString(out.SecretString), nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("secretsmanager:%s: %w", id, err)
+	}
+	if key == "" {
+		return secret, nil
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secretsmanager:%s: not a JSON secret", id)
+	}
+	value, ok := fields[key].(string)
+	if !ok {
+		return "", fmt.Errorf("secretsmanager:%s: no string key %s", id, key)
+	}
+	return value, nil
+}
+
+// Returns the cached value of a reference, looking it up with the function's credentials
+// the first time. The clients are built on the first lookup, from the default config.
+func (r *secretResolver) lookup(reference string, fetch func(ctx context.Context) (string, error)) (string, error) {
+	r.mu.Lock()
+	cached, ok := r.cache[reference]
+	r.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	r.once.Do(func() {
+		cfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil || cfg.Credentials == nil || cfg.Region == "" {
+			return
+		}
+		r.ssm = ssm.NewFromConfig(cfg)
+		r.secrets = secretsmanager.NewFromConfig(cfg)
+	})
+	if r.ssm == nil {
+		return "", errors.New("no AWS credentials or region to look it up with")
+	}
+	value, err := fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	r.cache[reference] = value
+	r.mu.Unlock()
+	return value, nil
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Telemetry API event types of schema 2022-12-13
+const (
+	TypeFunction                      = "function"
+	TypeExtension                     = "extension"
+	TypePlatformInitStart             = "platform.initStart"
+	TypePlatformInitRuntimeDone       = "platform.initRuntimeDone"
+	TypePlatformInitReport            = "platform.initReport"
+	TypePlatformStart                 = "platform.start"
+	TypePlatformRuntimeDone           = "platform.runtimeDone"
+	TypePlatformReport                = "platform.report"
+	TypePlatformRestoreStart          = "platform.restoreStart"
+	TypePlatformRestoreRuntimeDone    = "platform.restoreRuntimeDone"
+	TypePlatformRestoreReport         = "platform.restoreReport"
+	TypePlatformExtension             = "platform.extension"
+	TypePlatformTelemetrySubscription = "platform.telemetrySubscription"
+	TypePlatformLogsDropped           = "platform.logsDropped"
+)
+
+// Types only delivered by the Logs API, which is used when the Telemetry API isn't available.
+// Its other types share names and, for the fields read here, shapes with the Telemetry API.
+const (
+	TypePlatformEnd              = "platform.end"
+	TypePlatformFault            = "platform.fault"
+	TypePlatformLogsSubscription = "platform.logsSubscription"
+)
+
+// A phase of the platform's work, e.g. responseLatency or runtimeOverhead
+type Span struct {
+	Name       string  `json:"name"`
+	Start      string  `json:"start"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+type PlatformInitStartEvent struct {
+	// One of on-demand, provisioned-concurrency or snap-start
+	InitializationType string `json:"initializationType"`
+	// init, or invoke when the init is repeated after a failure
+	Phase             string `json:"phase"`
+	RuntimeVersion    string `json:"runtimeVersion"`
+	RuntimeVersionArn string `json:"runtimeVersionArn"`
+	FunctionName      string `json:"functionName"`
+	FunctionVersion   string `json:"functionVersion"`
+	InstanceID        string `json:"instanceId"`
+	InstanceMaxMemory int64  `json:"instanceMaxMemory"`
+}
+
+type PlatformInitRuntimeDoneEvent struct {
+	InitializationType string `json:"initializationType"`
+	Phase              string `json:"phase"`
+	// One of success, error or failure
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType,omitempty"`
+	Spans     []Span `json:"spans,omitempty"`
+}
+
+type InitReportMetrics struct {
+	DurationMs float64 `json:"durationMs"`
+}
+
+type PlatformInitReportEvent struct {
+	InitializationType string            `json:"initializationType"`
+	Phase              string            `json:"phase"`
+	Status             string            `json:"status"`
+	ErrorType          string            `json:"errorType,omitempty"`
+	Metrics            InitReportMetrics `json:"metrics"`
+	Spans              []Span            `json:"spans,omitempty"`
+}
+
+type PlatformStartEvent struct {
+	RequestID string `json:"requestId"`
+	Version   string `json:"version"`
+	// Only set when tracing is active for the function
+	Tracing *TraceContext `json:"tracing,omitempty"`
+}
+
+// Trace of an invocation, Value holds the X-Amzn-Trace-Id header
+type TraceContext struct {
+	SpanID string `json:"spanId"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+}
+
+type RuntimeDoneMetrics struct {
+	DurationMs    float64 `json:"durationMs"`
+	ProducedBytes int64   `json:"producedBytes"`
+}
+
+type PlatformRuntimeDone struct {
+	RequestID string `json:"requestId"`
+	// One of success, error, failure or timeout
+	Status    string             `json:"status"`
+	ErrorType string             `json:"errorType"`
+	Metrics   RuntimeDoneMetrics `json:"metrics"`
+	Tracing   *TraceContext      `json:"tracing,omitempty"`
+	Spans     []Span             `json:"spans,omitempty"`
+}
+
+type ReportMetrics struct {
+	DurationMs       float64 `json:"durationMs"`
+	BilledDurationMs int64   `json:"billedDurationMs"`
+	MemorySizeMb     int64   `json:"memorySizeMB"`
+	MaxMemoryUsedMb  int64   `json:"maxMemoryUsedMB"`
+	// Only set on the first invocation of an on-demand sandbox
+	InitDurationMs float64 `json:"initDurationMs,omitempty"`
+	// Only set on the first invocation of a SnapStart sandbox
+	RestoreDurationMs       float64 `json:"restoreDurationMs,omitempty"`
+	BilledRestoreDurationMs int64   `json:"billedRestoreDurationMs,omitempty"`
+}
+
+type PlatformReportEvent struct {
+	RequestID string        `json:"requestId"`
+	Status    string        `json:"status"`
+	ErrorType string        `json:"errorType,omitempty"`
+	Metrics   ReportMetrics `json:"metrics"`
+	Tracing   *TraceContext `json:"tracing,omitempty"`
+	Spans     []Span        `json:"spans,omitempty"`
+}
+
+type PlatformRestoreStartEvent struct {
+	RuntimeVersion    string `json:"runtimeVersion"`
+	RuntimeVersionArn string `json:"runtimeVersionArn"`
+	FunctionName      string `json:"functionName"`
+	FunctionVersion   string `json:"functionVersion"`
+	InstanceID        string `json:"instanceId"`
+	InstanceMaxMemory int64  `json:"instanceMaxMemory"`
+}
+
+type PlatformRestoreRuntimeDoneEvent struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType,omitempty"`
+	Spans     []Span `json:"spans,omitempty"`
+}
+
+type PlatformRestoreReportEvent struct {
+	Status    string            `json:"status"`
+	ErrorType string            `json:"errorType,omitempty"`
+	Metrics   InitReportMetrics `json:"metrics"`
+	Spans     []Span            `json:"spans,omitempty"`
+}
+
+// Registration of an extension, including this one
+type PlatformExtensionEvent struct {
+	Name string `json:"name"`
+	// Ready, or Failed when registration failed
+	State     string   `json:"state"`
+	Events    []string `json:"events"`
+	ErrorType string   `json:"errorType,omitempty"`
+}
+
+type PlatformTelemetrySubscriptionEvent struct {
+	Name  string   `json:"name"`
+	State string   `json:"state"`
+	Types []string `json:"types"`
+}
+
+// Telemetry the platform discarded because the listener didn't keep up
+type PlatformLogsDroppedEvent struct {
+	Reason         string `json:"reason"`
+	DroppedRecords int64  `json:"droppedRecords"`
+	DroppedBytes   int64  `json:"droppedBytes"`
+}
+
+// End of an invocation, as reported by the Logs API. Unlike runtimeDone it carries no
+// outcome, and the 2021-03-18 schema sends both for the same invocation.
+type PlatformEndEvent struct {
+	RequestID string `json:"requestId"`
+}
+
+// Description of a runtime or sandbox failure, as reported by the Logs API
+type PlatformFaultEvent string
+
+type FunctionEvent string
+
+// A line written by an extension, only delivered when subscribed to the extension stream
+type ExtensionEvent string
+
+// Invocation a platform event belongs to, empty for events that don't name one
+func (e Event) RequestID() string {
+	switch v := e.Record.(type) {
+	case PlatformStartEvent:
+		return v.RequestID
+	case PlatformRuntimeDone:
+		return v.RequestID
+	case PlatformReportEvent:
+		return v.RequestID
+	case PlatformEndEvent:
+		return v.RequestID
+	}
+	return ""
+}
+
+// Decodes the record of an event into its typed form
+func decode(eventType string, raw json.RawMessage) (interface{}, error) {
+	switch eventType {
+	case TypeFunction, TypeExtension:
+		// With AWS_LAMBDA_LOG_FORMAT=JSON the record is the JSON log object itself
+		var line string
+		if err := json.Unmarshal(raw, &line); err != nil {
+			line = string(raw)
+		}
+		if eventType == TypeExtension {
+			return ExtensionEvent(line), nil
+		}
+		return FunctionEvent(line), nil
+	case TypePlatformInitStart:
+		return as[PlatformInitStartEvent](eventType, raw)
+	case TypePlatformInitRuntimeDone:
+		return as[PlatformInitRuntimeDoneEvent](eventType, raw)
+	case TypePlatformInitReport:
+		return as[PlatformInitReportEvent](eventType, raw)
+	case TypePlatformStart:
+		return as[PlatformStartEvent](eventType, raw)
+	case TypePlatformRuntimeDone:
+		return as[PlatformRuntimeDone](eventType, raw)
+	case TypePlatformReport:
+		return as[PlatformReportEvent](eventType, raw)
+	case TypePlatformRestoreStart:
+		return as[PlatformRestoreStartEvent](eventType, raw)
+	case TypePlatformRestoreRuntimeDone:
+		return as[PlatformRestoreRuntimeDoneEvent](eventType, raw)
+	case TypePlatformRestoreReport:
+		return as[PlatformRestoreReportEvent](eventType, raw)
+	case TypePlatformExtension:
+		return as[PlatformExtensionEvent](eventType, raw)
+	case TypePlatformTelemetrySubscription:
+		return as[PlatformTelemetrySubscriptionEvent](eventType, raw)
+	case TypePlatformLogsDropped:
+		return as[PlatformLogsDroppedEvent](eventType, raw)
+	case TypePlatformEnd:
+		return as[PlatformEndEvent](eventType, raw)
+	case TypePlatformFault:
+		var fault string
+		if err := json.Unmarshal(raw, &fault); err != nil {
+			fault = string(raw)
+		}
+		return PlatformFaultEvent(fault), nil
+	case TypePlatformLogsSubscription:
+		return as[PlatformTelemetrySubscriptionEvent](eventType, raw)
+	default:
+		return nil, fmt.Errorf("unknown event type %q", eventType)
+	}
+}
+
+func as[T any](eventType string, raw json.RawMessage) (interface{}, error) {
+	var record T
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, fmt.Errorf("%s: %w", eventType, err)
+	}
+	return record, nil
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// A batch posted by the Logs API, schema 2021-03-18, to a subscribed extension
+const logsAPIPayload = `[
+	{"time":"2024-03-05T10:15:02.210Z","type":"platform.logsSubscription","record":{"name":"sst-extension","state":"Subscribed","types":["platform","function"]}},
+	{"time":"2024-03-05T10:15:02.240Z","type":"platform.extension","record":{"name":"sst-extension","state":"Ready","events":["INVOKE","SHUTDOWN"]}},
+	{"time":"2024-03-05T10:15:02.313Z","type":"platform.start","record":{"requestId":"6d68ca91-49c9-448d-89b8-7ca3e6dc66aa","version":"$LATEST"}},
+	{"time":"2024-03-05T10:15:02.315Z","type":"function","record":"2024-03-05T10:15:02.315Z\t6d68ca91-49c9-448d-89b8-7ca3e6dc66aa\tINFO\tcharging order 1234\n"},
+	{"time":"2024-03-05T10:15:02.352Z","type":"platform.fault","record":"RequestId: 6d68ca91-49c9-448d-89b8-7ca3e6dc66aa Process exited before completing request"},
+	{"time":"2024-03-05T10:15:02.352Z","type":"platform.runtimeDone","record":{"requestId":"6d68ca91-49c9-448d-89b8-7ca3e6dc66aa","status":"failure"}},
+	{"time":"2024-03-05T10:15:02.353Z","type":"platform.end","record":{"requestId":"6d68ca91-49c9-448d-89b8-7ca3e6dc66aa"}},
+	{"time":"2024-03-05T10:15:02.353Z","type":"platform.report","record":{"requestId":"6d68ca91-49c9-448d-89b8-7ca3e6dc66aa","metrics":{"durationMs":39.53,"billedDurationMs":40,"memorySizeMB":128,"maxMemoryUsedMB":71,"initDurationMs":182.7}}}
+]`
+
+func TestLogsAPIPayload(t *testing.T) {
+	listener := NewListener(QueueOptions{Size: 16})
+	events := listener.Subscribe()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(logsAPIPayload))
+	status, err := listener.receive(httptest.NewRecorder(), r, DefaultMaxBody)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("receive = %d, %v", status, err)
+	}
+
+	const requestID = "6d68ca91-49c9-448d-89b8-7ca3e6dc66aa"
+	want := []string{
+		TypePlatformLogsSubscription,
+		TypePlatformExtension,
+		TypePlatformStart,
+		TypeFunction,
+		TypePlatformFault,
+		TypePlatformRuntimeDone,
+		TypePlatformEnd,
+		TypePlatformReport,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, eventType := range want {
+		evt := <-events
+		if evt.Type != eventType {
+			t.Errorf("event %d has type %q, want %q", i, evt.Type, eventType)
+		}
+		switch v := evt.Record.(type) {
+		case PlatformTelemetrySubscriptionEvent:
+			if v.State != "Subscribed" || len(v.Types) != 2 {
+				t.Errorf("subscription = %+v", v)
+			}
+		case PlatformStartEvent:
+			if v.RequestID != requestID {
+				t.Errorf("start = %+v", v)
+			}
+		case FunctionEvent:
+			if !strings.HasSuffix(string(v), "\tINFO\tcharging order 1234\n") {
+				t.Errorf("function = %q", v)
+			}
+		case PlatformFaultEvent:
+			if !strings.Contains(string(v), "Process exited before completing request") {
+				t.Errorf("fault = %q", v)
+			}
+		case PlatformRuntimeDone:
+			if v.RequestID != requestID || v.Status != "failure" {
+				t.Errorf("runtimeDone = %+v", v)
+			}
+		case PlatformEndEvent:
+			if v.RequestID != requestID {
+				t.Errorf("end = %+v", v)
+			}
+		case PlatformReportEvent:
+			if v.RequestID != requestID || v.Metrics.DurationMs != 39.53 || v.Metrics.BilledDurationMs != 40 ||
+				v.Metrics.MemorySizeMb != 128 || v.Metrics.MaxMemoryUsedMb != 71 || v.Metrics.InitDurationMs != 182.7 {
+				t.Errorf("report = %+v", v)
+			}
+		}
+		if evt.RequestID() != "" && evt.RequestID() != requestID {
+			t.Errorf("event %d names request %q", i, evt.RequestID())
+		}
+	}
+}
+
+func TestDecodeUnknownType(t *testing.T) {
+	if _, err := decode("platform.unknown", []byte(`{}`)); err == nil {
+		t.Error("expected an error for an unknown type")
+	}
+}
@@ -4,20 +4,73 @@
 package server
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
-const defaultListenerPort = "4323"
-const initialQueueSize = 5
+// Ports the listeners bind to unless configured otherwise
+const (
+	DefaultPort    = 4323
+	DefaultTCPPort = 4324
+)
+
+// Hostname the Telemetry API reaches extensions under
+const DefaultHost = "sandbox"
+
+// Largest request body accepted unless configured otherwise. The Telemetry API buffers
+// at most 1 MiB of events, this leaves room for the JSON around them.
+const DefaultMaxBody = 4 << 20
+
+// Events buffered per subscriber unless configured otherwise
+const defaultQueueSize = 1000
+
+// Time the previous listener gets to finish its requests when a new one replaces it
+const restartTimeout = time.Second
+
+// What happens to an event when a subscriber's queue is full
+type DropPolicy string
+
+const (
+	// Wait for room, holding up the platform's delivery
+	DropNone DropPolicy = "block"
+	// Discard the event that didn't fit
+	DropNewest DropPolicy = "drop-newest"
+	// Discard the oldest queued event to make room
+	DropOldest DropPolicy = "drop-oldest"
+)
+
+// Bounds of the subscriber queues
+type QueueOptions struct {
+	// Defaults to 1000
+	Size   int
+	Policy DropPolicy
+}
 
-var httpServer *http.Server
-var Events chan Event
+// Where a listener binds
+type ListenerOptions struct {
+	// Defaults to DefaultHost. sandbox.localdomain works as well, 0.0.0.0 for local testing.
+	Host string
+	// Defaults to DefaultPort or DefaultTCPPort. A port taken by another extension is
+	// replaced with an ephemeral one.
+	Port int
+	// Largest request body accepted over HTTP, after decompression. Defaults to
+	// DefaultMaxBody, larger ones are refused with 413.
+	MaxBody int64
+}
 
 type UnknownEvent struct {
 	Time   string          `json:"time"`
@@ -26,145 +79,390 @@ type UnknownEvent struct {
 }
 
 type Event struct {
-	Time   string
+	// When the platform recorded the event, or received it if the timestamp is malformed
+	Time   time.Time
 	Type   string
 	Record interface{}
 }
 
-type PlatformInitStartEvent struct {
-	InitializationType string `json:"initializationType"`
-	Phase              string `json:"phase"`
-	RuntimeVersion     string `json:"runtimeVersion"`
-	RuntimeVersionArn  string `json:"runtimeVersionArn"`
+// Receives telemetry over HTTP or TCP and hands every event to each subscriber
+type Listener struct {
+	queue       QueueOptions
+	dropped     atomic.Int64
+	mu          sync.Mutex
+	subscribers []*subscriber
+	// Set by Shutdown, events published afterwards are discarded
+	closed bool
+	// Closed once Shutdown stops waiting, releasing publishers blocked on a full queue
+	done chan struct{}
+	// Broadcasts in flight, the subscriber channels are closed once they finished
+	publishers   sync.WaitGroup
+	failed       chan error
+	httpServer   *http.Server
+	httpListener net.Listener
+	tcpServer    *tcpListener
 }
 
-type PlatformStartEvent struct {
-	RequestID string `json:"requestId"`
-	Version   string `json:"version"`
+func NewListener(queue QueueOptions) *Listener {
+	if queue.Size <= 0 {
+		queue.Size = defaultQueueSize
+	}
+	if queue.Policy == "" {
+		queue.Policy = DropNone
+	}
+	return &Listener{
+		queue:  queue,
+		done:   make(chan struct{}),
+		failed: make(chan error, 1),
+	}
 }
 
-type PlatformRuntimeDone struct {
-	RequestID string `json:"requestId"`
-	Metrics   struct {
-		DurationMs float64 `json:"durationMs"`
-	} `json:"metrics"`
+type subscriber struct {
+	events chan Event
+	// Lossy subscribers miss events when they fall behind instead of holding up the others
+	lossy bool
 }
 
-type PlatformReportEvent struct {
-	RequestID string `json:"requestId"`
-	Metrics   struct {
-		DurationMs       float64 `json:"durationMs"`
-		BilledDurationMs int64   `json:"billedDurationMs"`
-		MemorySizeMb     int64   `json:"memorySizeMb"`
-		MaxMemoryUsedMb  int64   `json:"maxMemoryUsedMb"`
-		InitDurationMs   int64   `json:"initDurationMs"`
-	} `json:"metrics"`
+// Returns a channel receiving every event from now on, independently of other
+// subscribers. A full channel is handled according to the queue's drop policy, so it
+// must be drained continuously. It is closed by Shutdown.
+func (l *Listener) Subscribe() <-chan Event {
+	return l.add(&subscriber{events: make(chan Event, l.queue.Size)})
 }
 
-type FunctionEvent string
-
-// Starts the server in a goroutine where the log events will be sent
-func Start() (string, error) {
-	address := "sandbox:" + defaultListenerPort
-	httpServer = &http.Server{Addr: address}
-	Events = make(chan Event, 1000)
-
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			log.Println("[listener:http_handler] Error reading body:", err)
-			return
-		}
+// Events discarded by the drop policy so far
+func (l *Listener) Dropped() int64 {
+	return l.dropped.Load()
+}
 
-		// Parse and put the log messages into the queue
-		var slice []UnknownEvent
-		_ = json.Unmarshal(body, &slice)
-
-		for _, evt := range slice {
-			switch evt.Type {
-			case "platform.initStart":
-				var specific PlatformInitStartEvent
-				_ = json.Unmarshal(evt.Record, &specific)
-				Events <- Event{
-					Time:   evt.Time,
-					Type:   evt.Type,
-					Record: specific,
-				}
-				break
-			case "function":
-				var specific string
-				_ = json.Unmarshal(evt.Record, &specific)
-				Events <- Event{
-					Time:   evt.Time,
-					Type:   evt.Type,
-					Record: FunctionEvent(specific),
+// Like Subscribe for observers such as a live tail, which may lag or go away: events
+// that don't fit the buffer are dropped for it alone. The returned function unsubscribes
+// and closes the channel.
+func (l *Listener) Watch(size int) (<-chan Event, func()) {
+	watcher := &subscriber{events: make(chan Event, size), lossy: true}
+	l.add(watcher)
+	var once sync.Once
+	return watcher.events, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			for i, s := range l.subscribers {
+				if s == watcher {
+					l.subscribers = append(l.subscribers[:i:i], l.subscribers[i+1:]...)
+					close(watcher.events)
+					return
 				}
-				break
-			case "platform.start":
-				var specific PlatformStartEvent
-				_ = json.Unmarshal(evt.Record, &specific)
-				Events <- Event{
-					Time:   evt.Time,
-					Type:   evt.Type,
-					Record: specific,
-				}
-				break
-			case "platform.report":
-				var specific PlatformReportEvent
-				_ = json.Unmarshal(evt.Record, &specific)
-				Events <- Event{
-					Time:   evt.Time,
-					Type:   evt.Type,
-					Record: specific,
-				}
-				break
-			case "platform.runtimeDone":
-				var specific PlatformRuntimeDone
-				log.Println(string(evt.Record))
-				_ = json.Unmarshal(evt.Record, &specific)
-				Events <- Event{
-					Time:   evt.Time,
-					Type:   evt.Type,
-					Record: specific,
-				}
-				break
-			case "platform.extension":
-			case "platform.initReport":
-			case "platform.initRuntimeDone":
-			case "platform.telemetrySubscription":
-				break
-			default:
-				log.Println("unknown event type", evt.Type, string(evt.Record))
 			}
-		}
+		})
+	}
+}
 
-		slice = nil
+func (l *Listener) add(s *subscriber) <-chan Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.subscribers = append(l.subscribers, s)
+	return s.events
+}
+
+// Receives the error when the listener stops unexpectedly, so it can be restarted
+func (l *Listener) Failed() <-chan error {
+	return l.failed
+}
+
+// Starts the server in a goroutine where the log events will be sent, replacing any
+// listener started before. Returns the URI and port to subscribe with.
+func (l *Listener) Start(options ListenerOptions) (string, int, error) {
+	l.restart()
+	if options.Port == 0 {
+		options.Port = DefaultPort
+	}
+	listener, port, err := bind(&options)
+	if err != nil {
+		return "", 0, err
+	}
+	address := net.JoinHostPort(options.Host, strconv.Itoa(port))
+	if options.MaxBody <= 0 {
+		options.MaxBody = DefaultMaxBody
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if status, err := l.receive(w, r, options.MaxBody); err != nil {
+			log.Println("[listener:http_handler] Error reading body:", err)
+			http.Error(w, err.Error(), status)
+		}
 	})
+	server := &http.Server{Addr: address, Handler: mux}
+	l.mu.Lock()
+	l.httpServer = server
+	l.httpListener = listener
+	l.mu.Unlock()
 
 	go func() {
-		err := httpServer.ListenAndServe()
+		err := server.Serve(listener)
 		if err != http.ErrServerClosed {
 			log.Println("[listener:goroutine] Unexpected stop on Http Server:", err)
-			Shutdown()
+			l.fail(err)
 		} else {
 			log.Println("[listener:goroutine] Http Server closed:", err)
 		}
 	}()
 
-	return fmt.Sprintf("http://%s/", address), nil
+	return fmt.Sprintf("http://%s/", address), port, nil
+}
+
+// Inflaters reused across requests, each holds on to tens of KiB of window and tables
+var gzipReaders sync.Pool
+
+// Streams the batch of events in a request body of at most max bytes, inflating it if it
+// is gzip encoded. Chunked bodies are decoded by net/http already. The events are
+// published oldest first, since a batch may interleave the output of several invocations.
+// On failure it returns the status to respond with, the events decoded before the failure
+// are published all the same.
+func (l *Listener) receive(w http.ResponseWriter, r *http.Request, max int64) (int, error) {
+	var batch []Event
+	defer func() {
+		sort.SliceStable(batch, func(i, j int) bool {
+			return batch[i].Time.Before(batch[j].Time)
+		})
+		for _, event := range batch {
+			l.broadcast(event, r.Context().Done())
+		}
+	}()
+
+	// Bounds what is read off the wire, compressed or not
+	var reader io.Reader = http.MaxBytesReader(w, r.Body, max)
+	switch encoding := strings.ToLower(r.Header.Get("Content-Encoding")); encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		var gz *gzip.Reader
+		var err error
+		if pooled, ok := gzipReaders.Get().(*gzip.Reader); ok {
+			gz, err = pooled, pooled.Reset(reader)
+		} else {
+			gz, err = gzip.NewReader(reader)
+		}
+		if err != nil {
+			return statusFor(err, http.StatusBadRequest), err
+		}
+		defer gzipReaders.Put(gz)
+		// Bounds what it inflates to
+		reader = http.MaxBytesReader(w, io.NopCloser(gz), max)
+	default:
+		return http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	decoder := json.NewDecoder(reader)
+	if err := expect(decoder, json.Delim('[')); err == io.EOF {
+		// Nothing to deliver
+		return http.StatusOK, nil
+	} else if err != nil {
+		return statusFor(err, http.StatusBadRequest), err
+	}
+	// Reused for every event, the decoded event copies what it keeps out of the record
+	var evt UnknownEvent
+	for decoder.More() {
+		evt.Time, evt.Type, evt.Record = "", "", evt.Record[:0]
+		if err := decoder.Decode(&evt); err != nil {
+			return statusFor(err, http.StatusBadRequest), err
+		}
+		if event, ok := toEvent(evt); ok {
+			batch = append(batch, event)
+		}
+	}
+	if err := expect(decoder, json.Delim(']')); err != nil {
+		return statusFor(err, http.StatusBadRequest), err
+	}
+	return http.StatusOK, nil
 }
 
-// Terminates the HTTP server listening for logs
-func Shutdown() {
+// Reads the next token, failing unless it is the given one
+func expect(decoder *json.Decoder, want json.Token) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != want {
+		return fmt.Errorf("expected %v, got %v", want, token)
+	}
+	return nil
+}
+
+// Reports bodies cut off by http.MaxBytesReader as too large, anything else as fallback
+func statusFor(err error, fallback int) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return fallback
+}
+
+// Listens on the configured port, or an ephemeral one when it is taken
+func bind(options *ListenerOptions) (net.Listener, int, error) {
+	if options.Host == "" {
+		options.Host = DefaultHost
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(options.Host, strconv.Itoa(options.Port)))
+	if errors.Is(err, syscall.EADDRINUSE) {
+		log.Println("[listener:bind] Port", options.Port, "is in use, falling back to an ephemeral port")
+		listener, err = net.Listen("tcp", net.JoinHostPort(options.Host, "0"))
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return listener, listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (l *Listener) fail(err error) {
+	select {
+	case l.failed <- err:
+	default:
+	}
+}
+
+// Decodes an event and queues it for every subscriber, giving up on a full queue once
+// cancel is closed
+func (l *Listener) publish(evt UnknownEvent, cancel <-chan struct{}) {
+	if event, ok := toEvent(evt); ok {
+		l.broadcast(event, cancel)
+	}
+}
+
+// Decodes the record and timestamp of an event, reporting false for events to skip
+func toEvent(evt UnknownEvent) (Event, bool) {
+	record, err := decode(evt.Type, evt.Record)
+	if err != nil {
+		log.Println("[listener:publish] Skipping event:", err, string(evt.Record))
+		return Event{}, false
+	}
+	at, err := time.Parse(time.RFC3339Nano, evt.Time)
+	if err != nil {
+		at = time.Now()
+	}
+	return Event{
+		Time:   at,
+		Type:   evt.Type,
+		Record: record,
+	}, true
+}
+
+// Queues a decoded event for every subscriber. Waiting for room in a full queue stops
+// when cancel is closed or the listener shuts down.
+func (l *Listener) broadcast(event Event, cancel <-chan struct{}) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		l.dropped.Add(1)
+		return
+	}
+	l.publishers.Add(1)
+	defer l.publishers.Done()
+	for _, s := range l.subscribers {
+		if s.lossy {
+			select {
+			case s.events <- event:
+			default:
+			}
+		}
+	}
+	subscribers := l.subscribers
+	l.mu.Unlock()
+	for _, s := range subscribers {
+		if !s.lossy {
+			l.enqueue(s.events, event, cancel)
+		}
+	}
+}
+
+func (l *Listener) enqueue(events chan Event, event Event, cancel <-chan struct{}) {
+	switch l.queue.Policy {
+	case DropNewest:
+		select {
+		case events <- event:
+		default:
+			l.dropped.Add(1)
+		}
+	case DropOldest:
+		for {
+			select {
+			case events <- event:
+				return
+			default:
+			}
+			// The subscriber may have made room meanwhile, in which case nothing is dropped
+			select {
+			case <-events:
+				l.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case events <- event:
+		case <-l.done:
+			l.dropped.Add(1)
+		case <-cancel:
+			l.dropped.Add(1)
+		}
+	}
+}
+
+// Terminates the server listening for logs and closes the subscriber channels. Requests
+// still in flight are waited for until the context is done, events they are still
+// blocked on a full queue with are dropped then.
+func (l *Listener) Shutdown(ctx context.Context) {
+	l.stop(ctx)
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	published := make(chan struct{})
+	go func() {
+		l.publishers.Wait()
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-ctx.Done():
+	}
+	close(l.done)
+	<-published
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range l.subscribers {
+		close(s.events)
+	}
+	l.subscribers = nil
+}
+
+// Stops the previous listeners before starting new ones
+func (l *Listener) restart() {
+	ctx, cancel := context.WithTimeout(context.Background(), restartTimeout)
+	defer cancel()
+	l.stop(ctx)
+}
+
+// Stops the listeners, leaving the subscriber channels open for the next one
+func (l *Listener) stop(ctx context.Context) {
+	l.mu.Lock()
+	tcpServer, httpServer, httpListener := l.tcpServer, l.httpServer, l.httpListener
+	l.tcpServer, l.httpServer, l.httpListener = nil, nil, nil
+	l.mu.Unlock()
+
+	if tcpServer != nil {
+		tcpServer.close(ctx)
+	}
 	if httpServer != nil {
-		ctx, _ := context.WithTimeout(context.Background(), 1*time.Second)
 		err := httpServer.Shutdown(ctx)
-		close(Events)
-
 		if err != nil {
 			log.Println("[listener:Shutdown] Failed to shutdown http server gracefully:", err)
-		} else {
-			httpServer = nil
 		}
+		// Serve may not have taken the listener over yet, in which case Shutdown leaves it open
+		httpListener.Close()
 	}
 }
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+type tcpListener struct {
+	owner    *Listener
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	// Closed when close stops waiting, releasing readers blocked on a full queue
+	stopped chan struct{}
+}
+
+// Starts a TCP listener in a goroutine, for subscriptions with the TCP protocol. The
+// Telemetry API writes events to it as newline delimited JSON objects over long lived
+// connections, skipping the HTTP request per batch. Replaces any listener started before.
+// Returns the port to subscribe with.
+func (l *Listener) StartTCP(options ListenerOptions) (int, error) {
+	l.restart()
+	if options.Port == 0 {
+		options.Port = DefaultTCPPort
+	}
+	listener, port, err := bind(&options)
+	if err != nil {
+		return 0, err
+	}
+	server := &tcpListener{
+		owner:    l,
+		listener: listener,
+		conns:    map[net.Conn]struct{}{},
+		stopped:  make(chan struct{}),
+	}
+	l.mu.Lock()
+	l.tcpServer = server
+	l.mu.Unlock()
+	go server.serve()
+	return port, nil
+}
+
+func (l *tcpListener) serve() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				log.Println("[listener:tcp] TCP listener closed")
+				return
+			}
+			log.Println("[listener:tcp] Unexpected stop on TCP listener:", err)
+			l.owner.fail(err)
+			return
+		}
+		l.mu.Lock()
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+		l.wg.Add(1)
+		go l.read(conn)
+	}
+}
+
+// Decodes events from a connection until the platform closes it
+func (l *tcpListener) read(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		l.wg.Done()
+	}()
+	decoder := json.NewDecoder(conn)
+	// Reused for every event like the HTTP listener does
+	var evt UnknownEvent
+	for {
+		evt.Time, evt.Type, evt.Record = "", "", evt.Record[:0]
+		err := decoder.Decode(&evt)
+		if err == io.EOF || errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			// The stream can't be resynchronized after a malformed event
+			log.Println("[listener:tcp] Failed to decode event, dropping connection:", err)
+			return
+		}
+		l.owner.publish(evt, l.stopped)
+	}
+}
+
+// Stops accepting, drops open connections and waits for their readers to finish until
+// ctx is done. Readers still blocked on a full queue then drop their event.
+func (l *tcpListener) close(ctx context.Context) {
+	l.listener.Close()
+	l.mu.Lock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+	finished := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		log.Println("[listener:tcp] Gave up waiting for connections to finish:", ctx.Err())
+	}
+	close(l.stopped)
+}
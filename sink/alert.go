@@ -0,0 +1,61 @@
+package sink
+
+import "context"
+
+// Why an alert was raised
+type AlertReason string
+
+const (
+	// The invocation ran past its timeout
+	AlertTimeout AlertReason = "timeout"
+	// The runtime crashed while handling the invocation
+	AlertCrash AlertReason = "crash"
+	// The runtime ran out of memory
+	AlertOutOfMemory AlertReason = "oom"
+	// The function logged an error, identified by its fingerprint
+	AlertError AlertReason = "error"
+	// The extension is about to report an error to the platform and exit
+	AlertExtension AlertReason = "extension"
+)
+
+// A fatal failure worth notifying a human about
+type Alert struct {
+	Reason    AlertReason
+	RequestID string
+	Group     string
+	// Error type or message reported by the platform or the extension
+	Detail string
+	// Grouping key of the error for AlertError
+	Fingerprint string
+	// The most recent log lines of the invocation, oldest first
+	Lines []string
+}
+
+// A destination notified about fatal failures, as opposed to receiving every batch
+type Alerter interface {
+	Alert(ctx context.Context, alert *Alert) error
+}
+
+type reasonFilter struct {
+	alerter Alerter
+	reasons map[AlertReason]bool
+}
+
+// Forwards only alerts raised for one of the given reasons
+func OnlyReasons(alerter Alerter, reasons ...AlertReason) Alerter {
+	filter := &reasonFilter{
+		alerter: alerter,
+		reasons: map[AlertReason]bool{},
+	}
+	for _, reason := range reasons {
+		filter.reasons[reason] = true
+	}
+	return filter
+}
+
+func (f *reasonFilter) Alert(ctx context.Context, alert *Alert) error {
+	if !f.reasons[alert.Reason] {
+		return nil
+	}
+	return f.alerter.Alert(ctx, alert)
+}
@@ -0,0 +1,75 @@
+package sink
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Log group CloudWatch Application Signals reads its EMF metrics from
+const ApplicationSignalsGroup = "/aws/application-signals/data"
+
+const applicationSignalsNamespace = "ApplicationSignals"
+
+// Emits invocation metrics and span attributes in the shapes Application Signals
+// expects from its own instrumentation, so the service shows up without the ADOT layer
+type ApplicationSignals struct {
+	Service     string
+	Environment string
+	// Defaults to "<function>/FunctionHandler", the operation Application Signals uses for Lambda
+	Operation string
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+// Builds the EMF record carrying an invocation's latency and outcome. A failed
+// invocation counts as a fault, Lambda has no notion of client errors.
+func (a *ApplicationSignals) Metrics(end time.Time, duration time.Duration, failed bool) Entry {
+	fault := 0
+	if failed {
+		fault = 1
+	}
+	record := map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": end.UnixMilli(),
+			"CloudWatchMetrics": []emfDirective{{
+				Namespace:  applicationSignalsNamespace,
+				Dimensions: [][]string{{"Service", "Environment", "Operation"}, {"Service", "Environment"}},
+				Metrics: []emfMetric{
+					{Name: "Latency", Unit: "Milliseconds"},
+					{Name: "Error", Unit: "Count"},
+					{Name: "Fault", Unit: "Count"},
+				},
+			}},
+		},
+		"Service":          a.Service,
+		"Environment":      a.Environment,
+		"Operation":        a.Operation,
+		"PlatformType":     "AWS::Lambda",
+		"Telemetry.Source": "LocalRootSpan",
+		"Latency":          float64(duration.Microseconds()) / 1000,
+		"Error":            0,
+		"Fault":            fault,
+	}
+	message, _ := json.Marshal(record)
+	return Entry{Time: end, Message: string(message)}
+}
+
+// Adds the attributes Application Signals uses to attribute a span to the service
+func (a *ApplicationSignals) Annotate(span *Span) {
+	if span.Annotations == nil {
+		span.Annotations = map[string]string{}
+	}
+	span.Annotations["aws.local.service"] = a.Service
+	span.Annotations["aws.local.environment"] = a.Environment
+	span.Annotations["aws.local.operation"] = a.Operation
+	span.Annotations["aws.span.kind"] = "LOCAL_ROOT"
+}
@@ -0,0 +1,99 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const azureTokenScope = "https://monitor.azure.com//.default"
+
+// The Logs Ingestion API accepts up to 1MB per call
+var azureLimits = Limits{MaxBytes: 1000 * 1000, EntryOverhead: 256}
+
+type AzureOptions struct {
+	// Logs ingestion endpoint of the data collection endpoint or rule
+	Endpoint string
+	// Immutable id of the data collection rule, dcr-...
+	RuleID string
+	// Stream declared in the rule, e.g. Custom-LambdaLogs_CL
+	Stream string
+	// Entra ID application used to authenticate
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+}
+
+// Writes batches to Azure Monitor through the Logs Ingestion API.
+// The stream's columns should match azureRecord.
+type Azure struct {
+	httpClient *http.Client
+	url        string
+	tokens     *tokenCache
+}
+
+type azureRecord struct {
+	TimeGenerated string            `json:"TimeGenerated"`
+	Message       string            `json:"Message"`
+	Level         string            `json:"Level,omitempty"`
+	RequestID     string            `json:"RequestId,omitempty"`
+	LogGroup      string            `json:"LogGroup"`
+	Function      string            `json:"Function"`
+	Attributes    map[string]string `json:"Attributes,omitempty"`
+}
+
+func NewAzure(options AzureOptions) *Azure {
+	httpClient := &http.Client{}
+	tokenURL := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", url.PathEscape(options.TenantID))
+	return &Azure{
+		httpClient: httpClient,
+		url: fmt.Sprintf(
+			"%s/dataCollectionRules/%s/streams/%s?api-version=2023-01-01",
+			strings.TrimSuffix(options.Endpoint, "/"),
+			url.PathEscape(options.RuleID),
+			url.PathEscape(options.Stream),
+		),
+		tokens: &tokenCache{
+			fetch: func(ctx context.Context) (string, time.Duration, error) {
+				return requestToken(ctx, httpClient, tokenURL, url.Values{
+					"grant_type":    {"client_credentials"},
+					"client_id":     {options.ClientID},
+					"client_secret": {options.ClientSecret},
+					"scope":         {azureTokenScope},
+				})
+			},
+		},
+	}
+}
+
+func (a *Azure) Write(ctx context.Context, batch *Batch) error {
+	token, err := a.tokens.Get(ctx)
+	if err != nil {
+		return err
+	}
+	function := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	return writeChunked(batch, azureLimits, func(entries []Entry) error {
+		records := make([]azureRecord, 0, len(entries))
+		for _, entry := range entries {
+			records = append(records, azureRecord{
+				TimeGenerated: entry.Time.UTC().Format(time.RFC3339Nano),
+				Message:       entry.Message,
+				Level:         entry.Level,
+				RequestID:     batch.RequestID,
+				LogGroup:      batch.Group,
+				Function:      function,
+				Attributes:    entry.Attributes,
+			})
+		}
+		body, err := json.Marshal(records)
+		if err != nil {
+			return err
+		}
+		return post(ctx, a.httpClient, a.url, "application/json", token, body)
+	})
+}
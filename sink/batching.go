@@ -0,0 +1,89 @@
+package sink
+
+import "unicode/utf8"
+
+// Request size limits of a destination's write API
+type Limits struct {
+	// Maximum number of entries per request, zero for unlimited
+	MaxEntries int
+	// Maximum encoded size of a request in bytes, zero for unlimited
+	MaxBytes int
+	// Bytes counted for each entry on top of its message, covering the encoding overhead
+	EntryOverhead int
+	// Maximum size of one entry including its overhead, zero for unlimited. Longer
+	// messages are split across consecutive entries.
+	MaxEntryBytes int
+}
+
+// Splits messages exceeding MaxEntryBytes into consecutive entries with the same time,
+// level and attributes, cutting on UTF-8 boundaries. The entries are returned as is when
+// none is too long.
+func (l Limits) Split(entries []Entry) []Entry {
+	if l.MaxEntryBytes <= 0 {
+		return entries
+	}
+	max := l.MaxEntryBytes - l.EntryOverhead
+	var split []Entry
+	for i, entry := range entries {
+		if len(entry.Message) <= max {
+			if split != nil {
+				split = append(split, entry)
+			}
+			continue
+		}
+		if split == nil {
+			split = append(make([]Entry, 0, len(entries)+1), entries[:i]...)
+		}
+		for message := entry.Message; message != ""; {
+			cut := len(message)
+			if cut > max {
+				cut = max
+				for cut > 0 && !utf8.RuneStart(message[cut]) {
+					cut--
+				}
+				if cut == 0 {
+					cut = max
+				}
+			}
+			part := entry
+			part.Message = message[:cut]
+			split = append(split, part)
+			message = message[cut:]
+		}
+	}
+	if split == nil {
+		return entries
+	}
+	return split
+}
+
+// Splits entries into consecutive chunks that each fit into one request. An entry larger
+// than MaxBytes on its own is put in a chunk by itself and left for the sink to handle.
+func (l Limits) Chunk(entries []Entry) [][]Entry {
+	chunks := [][]Entry{}
+	start, size := 0, 0
+	for i, entry := range entries {
+		entrySize := len(entry.Message) + l.EntryOverhead
+		full := l.MaxEntries > 0 && i-start >= l.MaxEntries
+		tooBig := l.MaxBytes > 0 && size+entrySize > l.MaxBytes
+		if i > start && (full || tooBig) {
+			chunks = append(chunks, entries[start:i])
+			start, size = i, 0
+		}
+		size += entrySize
+	}
+	if start < len(entries) {
+		chunks = append(chunks, entries[start:])
+	}
+	return chunks
+}
+
+// Writes the batch as one request per chunk, stopping at the first failure
+func writeChunked(batch *Batch, limits Limits, write func(entries []Entry) error) error {
+	for _, chunk := range limits.Chunk(limits.Split(batch.Entries)) {
+		if err := write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
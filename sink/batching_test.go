@@ -0,0 +1,116 @@
+package sink
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// Entries with messages of the given lengths
+func entriesOf(lengths ...int) []Entry {
+	entries := make([]Entry, len(lengths))
+	for i, n := range lengths {
+		entries[i] = Entry{Message: strings.Repeat("a", n)}
+	}
+	return entries
+}
+
+// Lengths of n messages of the same size
+func repeat(n, length int) []int {
+	lengths := make([]int, n)
+	for i := range lengths {
+		lengths[i] = length
+	}
+	return lengths
+}
+
+func TestChunk(t *testing.T) {
+	// Fills a CloudWatch request to the byte once the 26 bytes of overhead are counted
+	const sixteenth = 1048576/16 - 26
+	cases := []struct {
+		name    string
+		entries []Entry
+		want    []int
+	}{
+		{"empty batch", nil, []int{}},
+		{"exactly 10,000 entries", entriesOf(repeat(10000, 10)...), []int{10000}},
+		{"one entry over 10,000", entriesOf(repeat(10001, 10)...), []int{10000, 1}},
+		{"exactly 1,048,576 bytes", entriesOf(repeat(16, sixteenth)...), []int{16}},
+		{"one byte over 1,048,576", entriesOf(append(repeat(15, sixteenth), sixteenth+1)...), []int{15, 1}},
+		{"overhead alone exceeding the limit", entriesOf(append(repeat(16, sixteenth), 0)...), []int{16, 1}},
+		{"entry larger than a request", entriesOf(10, 1048576, 10), []int{1, 1, 1}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			chunks := cloudWatchLimits.Chunk(c.entries)
+			if len(chunks) != len(c.want) {
+				t.Fatalf("got %d chunks, want %d", len(chunks), len(c.want))
+			}
+			for i, chunk := range chunks {
+				if len(chunk) != c.want[i] {
+					t.Errorf("chunk %d has %d entries, want %d", i, len(chunk), c.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	max := cloudWatchLimits.MaxEntryBytes - cloudWatchLimits.EntryOverhead
+	at := time.Date(2024, 3, 5, 10, 15, 2, 0, time.UTC)
+	cases := []struct {
+		name    string
+		message string
+		parts   int
+	}{
+		{"empty message", "", 1},
+		{"fits", strings.Repeat("a", max), 1},
+		{"one byte over", strings.Repeat("a", max+1), 2},
+		// 262,118 isn't a multiple of 3, so a cut at the limit would land mid-rune
+		{"multibyte over 256KB", strings.Repeat("€", 100000), 2},
+		{"mixed widths", strings.Repeat("aé€😀", 60000), 3},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			entry := Entry{Time: at, Message: c.message, Level: "ERROR", Attributes: map[string]string{"requestId": "6d68ca91"}}
+			split := cloudWatchLimits.Split([]Entry{entry})
+			if len(split) != c.parts {
+				t.Fatalf("got %d parts, want %d", len(split), c.parts)
+			}
+			var joined strings.Builder
+			for i, part := range split {
+				if len(part.Message) > max {
+					t.Errorf("part %d has %d bytes, more than %d", i, len(part.Message), max)
+				}
+				if !utf8.ValidString(part.Message) {
+					t.Errorf("part %d was cut mid-rune", i)
+				}
+				if !part.Time.Equal(at) || part.Level != "ERROR" || part.Attributes["requestId"] != "6d68ca91" {
+					t.Errorf("part %d lost the entry's time, level or attributes: %+v", i, part)
+				}
+				joined.WriteString(part.Message)
+			}
+			if joined.String() != c.message {
+				t.Error("parts don't add up to the message")
+			}
+		})
+	}
+}
+
+func TestSplitKeepsOrder(t *testing.T) {
+	entries := []Entry{{Message: "before"}, {Message: strings.Repeat("x", 300*1024)}, {Message: "after"}}
+	split := cloudWatchLimits.Split(entries)
+	if len(split) != 4 || split[0].Message != "before" || split[3].Message != "after" {
+		t.Fatalf("got %d entries, want before, the two parts and after", len(split))
+	}
+}
+
+func TestSplitEmptyBatch(t *testing.T) {
+	if split := cloudWatchLimits.Split(nil); len(split) != 0 {
+		t.Errorf("got %d entries, want none", len(split))
+	}
+	if chunks := cloudWatchLimits.Chunk(cloudWatchLimits.Split(nil)); len(chunks) != 0 {
+		t.Errorf("got %d chunks, want none", len(chunks))
+	}
+}
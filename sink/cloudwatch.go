@@ -0,0 +1,416 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/sst/extension/api/retry"
+)
+
+// Writes log lines to CloudWatch Logs, creating the log group and stream on demand
+type CloudWatch struct {
+	client     *cloudwatchlogs.Client
+	streamName string
+	entity     *CloudWatchEntity
+	pacer      *Pacer
+	retry      retry.Policy
+	mu         sync.Mutex
+	groups     GroupOptions
+	// Groups and streams known to exist
+	ready map[stream]bool
+	// Retention last set on each group
+	retained map[string]int
+	// Rotation of the sink's own stream, guarded by mu
+	rotation Rotation
+	started  time.Time
+	written  int
+	rotated  int
+}
+
+// Settings applied to the log groups the sink creates, so they comply with the account's
+// policies. Groups that exist already are left as they are.
+type GroupOptions struct {
+	// Days events are kept, 0 keeps them forever
+	RetentionDays int
+	Tags          map[string]string
+	// ARN of the KMS key events are encrypted with
+	KMSKeyID string
+}
+
+// When the sink moves on to a new stream of its own. Streams named by the batch are left
+// alone, their names carry the date if they need to.
+type Rotation struct {
+	// Bytes written to a stream before the next one is started, 0 for no limit
+	MaxBytes int
+	// Age of a stream before the next one is started, 0 for no limit
+	MaxAge time.Duration
+	// Start a new stream when the date changes
+	Daily bool
+	// Names the stream started at the given time, after rotating the given number of times
+	Name func(at time.Time, rotated int) string
+}
+
+// Log stream of a group
+type stream struct {
+	group string
+	name  string
+}
+
+// Entity the delivered logs are attributed to, so CloudWatch Application Signals can
+// correlate them with the service's metrics and traces
+type CloudWatchEntity struct {
+	KeyAttributes map[string]string `json:"keyAttributes"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+}
+
+// Builds the entity of a Lambda function reported as the given service and environment
+func LambdaEntity(service string, environment string, function string) *CloudWatchEntity {
+	return &CloudWatchEntity{
+		KeyAttributes: map[string]string{
+			"Type":        "Service",
+			"Name":        service,
+			"Environment": environment,
+		},
+		Attributes: map[string]string{
+			"PlatformType":    "AWS::Lambda",
+			"Lambda.Function": function,
+		},
+	}
+}
+
+func NewCloudWatch(client *cloudwatchlogs.Client, streamName string) *CloudWatch {
+	return &CloudWatch{
+		client:     client,
+		streamName: streamName,
+		started:    time.Now(),
+		ready:      map[stream]bool{},
+		retained:   map[string]int{},
+		retry: retry.Policy{
+			MaxAttempts:  5,
+			InitialDelay: 100 * time.Millisecond,
+			MaxDelay:     2 * time.Second,
+			Retryable:    retryableCloudWatch,
+		},
+	}
+}
+
+// Replaces the backoff of failed PutLogEvents calls. Retries stop at the deadline of the
+// write's context all the same.
+func (c *CloudWatch) WithRetry(policy retry.Policy) *CloudWatch {
+	policy.Retryable = retryableCloudWatch
+	c.retry = policy
+	return c
+}
+
+// Attaches an entity to every PutLogEvents call
+func (c *CloudWatch) WithEntity(entity *CloudWatchEntity) *CloudWatch {
+	c.entity = entity
+	return c
+}
+
+// Sets the retention, tags and encryption of the log groups the sink creates
+func (c *CloudWatch) WithGroupOptions(options GroupOptions) *CloudWatch {
+	c.groups = options
+	return c
+}
+
+// Rotates the sink's own stream, the stream it was created with counts as the first one
+func (c *CloudWatch) WithRotation(rotation Rotation) *CloudWatch {
+	c.rotation = rotation
+	return c
+}
+
+// Returns the stream batches without one of their own are written to at the moment
+func (c *CloudWatch) Stream() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.streamName
+}
+
+// Returns the sink's own stream for a write at the given time, starting the next one
+// first if the current one is due
+func (c *CloudWatch) rotate(at time.Time) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := c.rotation
+	if r.Name == nil {
+		return c.streamName
+	}
+	due := r.MaxBytes > 0 && c.written >= r.MaxBytes ||
+		r.MaxAge > 0 && at.Sub(c.started) >= r.MaxAge ||
+		r.Daily && at.Format("2006/01/02") != c.started.Format("2006/01/02")
+	if due {
+		c.rotated++
+		c.started = at
+		c.written = 0
+		c.streamName = r.Name(at, c.rotated)
+		log.Println("[cloudwatch:Write] Rotating to log stream", c.streamName)
+	}
+	return c.streamName
+}
+
+// Paces PutLogEvents calls to share the account quota with other sandboxes
+func (c *CloudWatch) WithPacer(pacer *Pacer) *CloudWatch {
+	c.pacer = pacer
+	return c
+}
+
+// PutLogEvents quotas, each event counts 26 bytes on top of its message
+var cloudWatchLimits = Limits{MaxEntries: 10000, MaxBytes: 1048576, EntryOverhead: 26, MaxEntryBytes: 256 * 1024}
+
+// Sends the batch to its log group, in as many PutLogEvents calls as its size requires.
+// If the group or stream does not exist yet they are created and the write is retried.
+func (c *CloudWatch) Write(ctx context.Context, batch *Batch) error {
+	if batch.Group == "" && len(batch.Entries) > 0 {
+		return errors.New("batch has no log group, split its logs or set SST_EXTENSION_DEFAULT_LOG_GROUP")
+	}
+	// The events of a call have to be in chronological order
+	entries := append([]Entry(nil), batch.Entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	sorted := *batch
+	sorted.Entries = entries
+	target := stream{group: batch.Group, name: batch.Stream}
+	if target.name == "" {
+		target.name = c.rotate(time.Now())
+	}
+	c.ensure(ctx, target)
+	if batch.Retention > 0 {
+		c.retain(ctx, batch.Group, batch.Retention)
+	}
+	return writeChunked(&sorted, cloudWatchLimits, func(entries []Entry) error {
+		err := c.put(ctx, target, entries)
+		if err == nil && batch.Stream == "" {
+			c.mu.Lock()
+			for _, entry := range entries {
+				c.written += len(entry.Message) + cloudWatchLimits.EntryOverhead
+			}
+			c.mu.Unlock()
+		}
+		return err
+	})
+}
+
+// Sends one call's worth of events
+func (c *CloudWatch) put(ctx context.Context, target stream, entries []Entry) error {
+	put := &cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(target.group),
+		LogStreamName: aws.String(target.name),
+		LogEvents:     make([]types.InputLogEvent, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		put.LogEvents = append(put.LogEvents, types.InputLogEvent{
+			Message:   aws.String(entry.Message),
+			Timestamp: aws.Int64(entry.Time.UnixMilli()),
+		})
+	}
+	options := []func(*cloudwatchlogs.Options){}
+	if c.entity != nil {
+		options = append(options, func(o *cloudwatchlogs.Options) {
+			o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+				return stack.Serialize.Add(&entityMiddleware{entity: c.entity}, middleware.After)
+			})
+		})
+	}
+	created := false
+	return c.retry.Do(ctx, "cloudwatch", func() error {
+		if c.pacer != nil {
+			if err := c.pacer.Wait(ctx); err != nil {
+				return err
+			}
+		}
+		_, err := c.client.PutLogEvents(ctx, put, options...)
+		code := ""
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			code = apiErr.ErrorCode()
+		}
+		if c.pacer != nil {
+			if code == "ThrottlingException" {
+				c.pacer.Throttled()
+			} else if err == nil {
+				c.pacer.Succeeded()
+			}
+		}
+		switch code {
+		case "DataAlreadyAcceptedException":
+			// An earlier attempt went through after all
+			return nil
+		case "ResourceNotFoundException":
+			if created {
+				return err
+			}
+			// Deleted since it was created, or its creation failed before
+			created = true
+			c.mu.Lock()
+			delete(c.ready, target)
+			c.mu.Unlock()
+			c.ensure(ctx, target)
+			return &retryableError{err}
+		}
+		return err
+	})
+}
+
+// Creates the stream, and the group if needed, before the first write to a group. Other
+// sandboxes of the function create the same groups concurrently, so finding them already
+// there counts as success. Failures are only logged, PutLogEvents reports what is wrong.
+func (c *CloudWatch) ensure(ctx context.Context, target stream) {
+	c.mu.Lock()
+	ready := c.ready[target]
+	c.mu.Unlock()
+	if ready {
+		return
+	}
+	createStream := func() error {
+		_, err := c.client.CreateLogStream(ctx, &cloudwatchlogs.CreateLogStreamInput{
+			LogGroupName:  aws.String(target.group),
+			LogStreamName: aws.String(target.name),
+		})
+		return err
+	}
+	err := createStream()
+	if hasCode(err, "ResourceNotFoundException") {
+		log.Println("[cloudwatch:Write] Creating log group", target.group)
+		create := &cloudwatchlogs.CreateLogGroupInput{
+			LogGroupName: aws.String(target.group),
+		}
+		if c.groups.KMSKeyID != "" {
+			create.KmsKeyId = aws.String(c.groups.KMSKeyID)
+		}
+		if len(c.groups.Tags) > 0 {
+			create.Tags = c.groups.Tags
+		}
+		_, err = c.client.CreateLogGroup(ctx, create)
+		if err != nil && !hasCode(err, "ResourceAlreadyExistsException") {
+			log.Println("[cloudwatch:Write] Failed to create log group:", err)
+			return
+		}
+		if err == nil && c.groups.RetentionDays > 0 {
+			c.retain(ctx, target.group, c.groups.RetentionDays)
+		}
+		err = createStream()
+	}
+	if err != nil && !hasCode(err, "ResourceAlreadyExistsException") {
+		log.Println("[cloudwatch:Write] Failed to create log stream:", err)
+		return
+	}
+	c.mu.Lock()
+	c.ready[target] = true
+	c.mu.Unlock()
+}
+
+// Sets the retention of a group unless it was set to the same already. The group is
+// usable without it, so failures are only logged and the write goes ahead.
+func (c *CloudWatch) retain(ctx context.Context, group string, days int) {
+	c.mu.Lock()
+	retained := c.retained[group] == days
+	c.mu.Unlock()
+	if retained {
+		return
+	}
+	_, err := c.client.PutRetentionPolicy(ctx, &cloudwatchlogs.PutRetentionPolicyInput{
+		LogGroupName:    aws.String(group),
+		RetentionInDays: aws.Int32(int32(days)),
+	})
+	if err != nil {
+		log.Println("[cloudwatch:Write] Failed to set log group retention:", err)
+		return
+	}
+	c.mu.Lock()
+	c.retained[group] = days
+	c.mu.Unlock()
+}
+
+// Reports whether err is an API error with the given code
+func hasCode(err error, code string) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == code
+}
+
+// Retries throttling, stale sequence tokens and outages, and the write after creating a
+// missing group or stream. Anything else, e.g. an access denial or a rejected batch,
+// fails the same way on every attempt.
+func retryableCloudWatch(err error) bool {
+	var retryable *retryableError
+	if errors.As(err, &retryable) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		// Connection failures and timeouts of a single attempt
+		return true
+	}
+	switch apiErr.ErrorCode() {
+	case "ThrottlingException", "InvalidSequenceTokenException", "ServiceUnavailableException":
+		return true
+	}
+	return false
+}
+
+// Marks an error as worth another attempt whatever its code
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// Adds the entity to the serialized PutLogEvents request. The pinned SDK predates the
+// entity member, the API accepts it all the same.
+type entityMiddleware struct {
+	entity *CloudWatchEntity
+}
+
+func (m *entityMiddleware) ID() string {
+	return "PutLogEventsEntity"
+}
+
+func (m *entityMiddleware) HandleSerialize(ctx context.Context, in middleware.SerializeInput, next middleware.SerializeHandler) (
+	middleware.SerializeOutput, middleware.Metadata, error,
+) {
+	req, ok := in.Request.(*smithyhttp.Request)
+	if !ok {
+		return middleware.SerializeOutput{}, middleware.Metadata{}, fmt.Errorf("unexpected request type %T", in.Request)
+	}
+	body := map[string]interface{}{}
+	if stream := req.GetStream(); stream != nil {
+		decoder := json.NewDecoder(stream)
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil && err != io.EOF {
+			return middleware.SerializeOutput{}, middleware.Metadata{}, err
+		}
+	}
+	body["entity"] = m.entity
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return middleware.SerializeOutput{}, middleware.Metadata{}, err
+	}
+	if in.Request, err = req.SetStream(bytes.NewReader(encoded)); err != nil {
+		return middleware.SerializeOutput{}, middleware.Metadata{}, err
+	}
+	return next.HandleSerialize(ctx, in)
+}
@@ -0,0 +1,277 @@
+//go:build integration
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/sst/extension/api/retry"
+)
+
+// Runs against LocalStack (or any CloudWatch Logs compatible endpoint).
+// Start one with ./scripts/integration or point LOCALSTACK_ENDPOINT at an existing instance.
+func localstackEndpoint() string {
+	endpoint := os.Getenv("LOCALSTACK_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://localhost:4566"
+	}
+	return endpoint
+}
+
+var localstackCredentials = credentials.NewStaticCredentialsProvider("test", "test", "")
+
+func localstack(t *testing.T) *cloudwatchlogs.Client {
+	return cloudwatchlogs.New(cloudwatchlogs.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(localstackEndpoint()),
+		Credentials:  localstackCredentials,
+	})
+}
+
+func uniqueName(t *testing.T) string {
+	return fmt.Sprintf("/sst/integration/%s/%d", t.Name(), time.Now().UnixNano())
+}
+
+// Reads every event of the stream, following the pages GetLogEvents splits them into
+func readMessages(t *testing.T, client *cloudwatchlogs.Client, group string, stream string) []string {
+	messages := []string{}
+	var token *string
+	for {
+		out, err := client.GetLogEvents(context.Background(), &cloudwatchlogs.GetLogEventsInput{
+			LogGroupName:  aws.String(group),
+			LogStreamName: aws.String(stream),
+			StartFromHead: aws.Bool(true),
+			NextToken:     token,
+		})
+		if err != nil {
+			t.Fatalf("GetLogEvents: %v", err)
+		}
+		for _, evt := range out.Events {
+			messages = append(messages, aws.ToString(evt.Message))
+		}
+		// The last page hands back the token it was read with
+		if len(out.Events) == 0 || aws.ToString(out.NextForwardToken) == aws.ToString(token) {
+			return messages
+		}
+		token = out.NextForwardToken
+	}
+}
+
+func batch(group string, messages ...string) *Batch {
+	b := &Batch{Group: group}
+	for _, message := range messages {
+		b.Entries = append(b.Entries, Entry{Time: time.Now(), Message: message})
+	}
+	return b
+}
+
+func assertMessages(t *testing.T, got []string, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d messages, got %d: %v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("message %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestCloudWatchCreatesGroupAndStream(t *testing.T) {
+	client := localstack(t)
+	group := uniqueName(t)
+	cw := NewCloudWatch(client, "2024/01/01/stream")
+
+	err := cw.Write(context.Background(), batch(group, "START", "hello", "END"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	groups, err := client.DescribeLogGroups(context.Background(), &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(group),
+	})
+	if err != nil {
+		t.Fatalf("DescribeLogGroups: %v", err)
+	}
+	if len(groups.LogGroups) != 1 {
+		t.Fatalf("expected log group %s to be created", group)
+	}
+
+	assertMessages(t, readMessages(t, client, group, "2024/01/01/stream"), []string{"START", "hello", "END"})
+}
+
+func TestCloudWatchReusesExistingStream(t *testing.T) {
+	client := localstack(t)
+	group := uniqueName(t)
+	cw := NewCloudWatch(client, "2024/01/01/stream")
+
+	for _, message := range []string{"first", "second"} {
+		err := cw.Write(context.Background(), batch(group, message))
+		if err != nil {
+			t.Fatalf("Write %s: %v", message, err)
+		}
+	}
+
+	assertMessages(t, readMessages(t, client, group, "2024/01/01/stream"), []string{"first", "second"})
+}
+
+func TestCloudWatchRecreatesDeletedGroup(t *testing.T) {
+	client := localstack(t)
+	group := uniqueName(t)
+	cw := NewCloudWatch(client, "2024/01/01/stream")
+
+	err := cw.Write(context.Background(), batch(group, "before"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	_, err = client.DeleteLogGroup(context.Background(), &cloudwatchlogs.DeleteLogGroupInput{
+		LogGroupName: aws.String(group),
+	})
+	if err != nil {
+		t.Fatalf("DeleteLogGroup: %v", err)
+	}
+
+	err = cw.Write(context.Background(), batch(group, "after"))
+	if err != nil {
+		t.Fatalf("Write after delete: %v", err)
+	}
+	assertMessages(t, readMessages(t, client, group, "2024/01/01/stream"), []string{"after"})
+}
+
+// A client counting its PutLogEvents calls, the first throttled ones fail with a
+// ThrottlingException before reaching the endpoint
+func countingLocalstack(t *testing.T, throttled int) (*cloudwatchlogs.Client, *atomic.Int32) {
+	calls := &atomic.Int32{}
+	client := cloudwatchlogs.New(cloudwatchlogs.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(localstackEndpoint()),
+		Credentials:  localstackCredentials,
+		APIOptions: []func(*middleware.Stack) error{func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("countPutLogEvents", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				if _, ok := in.Parameters.(*cloudwatchlogs.PutLogEventsInput); ok {
+					if calls.Add(1) <= int32(throttled) {
+						return middleware.InitializeOutput{}, middleware.Metadata{}, &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+					}
+				}
+				return next.HandleInitialize(ctx, in)
+			}), middleware.After)
+		}},
+	})
+	return client, calls
+}
+
+func TestCloudWatchChunksOversizedBatch(t *testing.T) {
+	cases := []struct {
+		name     string
+		messages []string
+		calls    int32
+	}{
+		{"over 10,000 events", numbered(10001, 1), 2},
+		{"over 1 MiB", numbered(5, 250*1024), 2},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client, calls := countingLocalstack(t, 0)
+			group := uniqueName(t)
+			cw := NewCloudWatch(client, "2024/01/01/stream")
+
+			if err := cw.Write(context.Background(), batch(group, c.messages...)); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if got := calls.Load(); got != c.calls {
+				t.Errorf("expected %d PutLogEvents calls, got %d", c.calls, got)
+			}
+			got := readMessages(t, client, group, "2024/01/01/stream")
+			if len(got) != len(c.messages) {
+				t.Fatalf("expected %d messages, got %d", len(c.messages), len(got))
+			}
+			for i := range c.messages {
+				if got[i] != c.messages[i] {
+					t.Fatalf("message %d was reordered or altered", i)
+				}
+			}
+		})
+	}
+}
+
+// Distinct messages of at least size bytes each, in the order they are numbered
+func numbered(n int, size int) []string {
+	messages := make([]string, n)
+	for i := range messages {
+		prefix := fmt.Sprintf("%05d ", i)
+		messages[i] = prefix + strings.Repeat("x", max(0, size-len(prefix)))
+	}
+	return messages
+}
+
+func TestCloudWatchSplitsLongMessage(t *testing.T) {
+	client := localstack(t)
+	group := uniqueName(t)
+	cw := NewCloudWatch(client, "2024/01/01/stream")
+	// 300,000 bytes of three-byte runes, cut where the limit falls mid-rune
+	message := strings.Repeat("€", 100000)
+
+	if err := cw.Write(context.Background(), batch(group, message)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	got := readMessages(t, client, group, "2024/01/01/stream")
+	if len(got) != 2 {
+		t.Fatalf("expected the message in 2 events, got %d", len(got))
+	}
+	for i, part := range got {
+		if !utf8.ValidString(part) {
+			t.Errorf("event %d was cut mid-rune", i)
+		}
+	}
+	if strings.Join(got, "") != message {
+		t.Error("events don't add up to the message")
+	}
+}
+
+func TestCloudWatchRetriesThrottling(t *testing.T) {
+	client, calls := countingLocalstack(t, 2)
+	group := uniqueName(t)
+	cw := NewCloudWatch(client, "2024/01/01/stream").WithRetry(retry.Policy{
+		MaxAttempts:  3,
+		InitialDelay: 10 * time.Millisecond,
+		MaxDelay:     50 * time.Millisecond,
+	})
+
+	if err := cw.Write(context.Background(), batch(group, "throttled")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("expected 3 PutLogEvents attempts, got %d", got)
+	}
+	assertMessages(t, readMessages(t, client, group, "2024/01/01/stream"), []string{"throttled"})
+}
+
+func TestCloudWatchGivesUpOnPersistentThrottling(t *testing.T) {
+	client, calls := countingLocalstack(t, 10)
+	group := uniqueName(t)
+	cw := NewCloudWatch(client, "2024/01/01/stream").WithRetry(retry.Policy{
+		MaxAttempts:  3,
+		InitialDelay: 10 * time.Millisecond,
+		MaxDelay:     50 * time.Millisecond,
+	})
+
+	err := cw.Write(context.Background(), batch(group, "throttled"))
+	if !hasCode(err, "ThrottlingException") {
+		t.Fatalf("expected the ThrottlingException, got %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("expected 3 PutLogEvents attempts, got %d", got)
+	}
+}
@@ -0,0 +1,61 @@
+package sink
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type dedupe struct {
+	sink   Sink
+	window time.Duration
+	key    func(entry Entry) string
+	mu     sync.Mutex
+	seen   map[string]time.Time
+}
+
+// Drops entries whose key was already written to the sink within the window, e.g. a
+// second summary line for an invocation. Entries with an empty key always pass.
+func Dedupe(sink Sink, window time.Duration, key func(entry Entry) string) Sink {
+	return &dedupe{
+		sink:   sink,
+		window: window,
+		key:    key,
+		seen:   map[string]time.Time{},
+	}
+}
+
+func (d *dedupe) Write(ctx context.Context, batch *Batch) error {
+	d.mu.Lock()
+	now := time.Now()
+	for key, at := range d.seen {
+		if now.Sub(at) > d.window {
+			delete(d.seen, key)
+		}
+	}
+	filtered := *batch
+	filtered.Entries = make([]Entry, 0, len(batch.Entries))
+	keys := []string{}
+	for _, entry := range batch.Entries {
+		key := d.key(entry)
+		if key != "" {
+			if _, ok := d.seen[key]; ok {
+				continue
+			}
+			keys = append(keys, key)
+		}
+		filtered.Entries = append(filtered.Entries, entry)
+	}
+	d.mu.Unlock()
+
+	if err := d.sink.Write(ctx, &filtered); err != nil {
+		return err
+	}
+	// Only remembered once written, a failed batch is retried in full
+	d.mu.Lock()
+	for _, key := range keys {
+		d.seen[key] = now
+	}
+	d.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,42 @@
+package sink
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// A value recorded in an EMF record
+type Metric struct {
+	Name string
+	// One of the CloudWatch units, e.g. Count or Milliseconds. Empty for None
+	Unit  string
+	Value float64
+}
+
+// Builds an Embedded Metric Format record, which CloudWatch turns into metrics in the
+// namespace when it reaches any log group. The dimensions form a single dimension set.
+func EMF(namespace string, at time.Time, dimensions map[string]string, metrics []Metric) Entry {
+	names := make([]string, 0, len(dimensions))
+	record := map[string]interface{}{}
+	for name, value := range dimensions {
+		names = append(names, name)
+		record[name] = value
+	}
+	sort.Strings(names)
+	directive := emfDirective{Namespace: namespace, Dimensions: [][]string{names}}
+	for _, metric := range metrics {
+		unit := metric.Unit
+		if unit == "" {
+			unit = "None"
+		}
+		directive.Metrics = append(directive.Metrics, emfMetric{Name: metric.Name, Unit: unit})
+		record[metric.Name] = metric.Value
+	}
+	record["_aws"] = map[string]interface{}{
+		"Timestamp":         at.UnixMilli(),
+		"CloudWatchMetrics": []emfDirective{directive},
+	}
+	message, _ := json.Marshal(record)
+	return Entry{Time: at, Message: string(message)}
+}
@@ -0,0 +1,205 @@
+package sink
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	gcpWriteURL   = "https://logging.googleapis.com/v2/entries:write"
+	gcpTokenScope = "https://www.googleapis.com/auth/logging.write"
+)
+
+// entries:write accepts up to 10MB per request, leave room for the envelope
+var gcpLimits = Limits{MaxEntries: 1000, MaxBytes: 9 * 1024 * 1024, EntryOverhead: 256}
+
+type GCPOptions struct {
+	// Service account key, either the JSON itself or a path to the key file
+	Credentials string
+	// Project the entries are written to, defaults to the service account's project
+	ProjectID string
+	// Log name within the project
+	LogID string
+}
+
+// Writes batches to Google Cloud Logging, authenticating as a service account
+type GCP struct {
+	httpClient *http.Client
+	logName    string
+	projectID  string
+	tokens     *tokenCache
+}
+
+type gcpServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+	ProjectID   string `json:"project_id"`
+}
+
+type gcpEntry struct {
+	Timestamp string            `json:"timestamp"`
+	Severity  string            `json:"severity"`
+	Payload   string            `json:"textPayload"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type gcpWriteRequest struct {
+	LogName  string            `json:"logName"`
+	Resource gcpResource       `json:"resource"`
+	Labels   map[string]string `json:"labels"`
+	Entries  []gcpEntry        `json:"entries"`
+}
+
+type gcpResource struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels"`
+}
+
+var gcpSeverities = map[string]string{
+	"TRACE": "DEBUG",
+	"DEBUG": "DEBUG",
+	"INFO":  "INFO",
+	"WARN":  "WARNING",
+	"ERROR": "ERROR",
+	"FATAL": "CRITICAL",
+}
+
+func NewGCP(options GCPOptions) (*GCP, error) {
+	raw := []byte(options.Credentials)
+	if !strings.HasPrefix(strings.TrimSpace(options.Credentials), "{") {
+		var err error
+		raw, err = os.ReadFile(options.Credentials)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var account gcpServiceAccount
+	if err := json.Unmarshal(raw, &account); err != nil {
+		return nil, fmt.Errorf("invalid service account key: %w", err)
+	}
+	key, err := parseRSAKey(account.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	projectID := options.ProjectID
+	if projectID == "" {
+		projectID = account.ProjectID
+	}
+	logID := options.LogID
+	if logID == "" {
+		logID = "lambda"
+	}
+
+	httpClient := &http.Client{}
+	return &GCP{
+		httpClient: httpClient,
+		logName:    fmt.Sprintf("projects/%s/logs/%s", projectID, url.PathEscape(logID)),
+		projectID:  projectID,
+		tokens: &tokenCache{
+			fetch: func(ctx context.Context) (string, time.Duration, error) {
+				assertion, err := gcpAssertion(account, key)
+				if err != nil {
+					return "", 0, err
+				}
+				return requestToken(ctx, httpClient, account.TokenURI, url.Values{
+					"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+					"assertion":  {assertion},
+				})
+			},
+		},
+	}, nil
+}
+
+func (g *GCP) Write(ctx context.Context, batch *Batch) error {
+	token, err := g.tokens.Get(ctx)
+	if err != nil {
+		return err
+	}
+	return writeChunked(batch, gcpLimits, func(entries []Entry) error {
+		req := gcpWriteRequest{
+			LogName: g.logName,
+			Resource: gcpResource{
+				Type:   "global",
+				Labels: map[string]string{"project_id": g.projectID},
+			},
+			Labels: map[string]string{
+				"function":  os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+				"region":    os.Getenv("AWS_REGION"),
+				"log_group": batch.Group,
+			},
+			Entries: make([]gcpEntry, 0, len(entries)),
+		}
+		if batch.RequestID != "" {
+			req.Labels["request_id"] = batch.RequestID
+		}
+		for _, entry := range entries {
+			severity, ok := gcpSeverities[entry.Level]
+			if !ok {
+				severity = "DEFAULT"
+			}
+			req.Entries = append(req.Entries, gcpEntry{
+				Timestamp: entry.Time.UTC().Format(time.RFC3339Nano),
+				Severity:  severity,
+				Payload:   entry.Message,
+				Labels:    entry.Attributes,
+			})
+		}
+		body, err := json.Marshal(&req)
+		if err != nil {
+			return err
+		}
+		return post(ctx, g.httpClient, gcpWriteURL, "application/json", token, body)
+	})
+}
+
+// Builds the signed JWT exchanged for an access token
+func gcpAssertion(account gcpServiceAccount, key *rsa.PrivateKey) (string, error) {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   account.ClientEmail,
+		"scope": gcpTokenScope,
+		"aud":   account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func parseRSAKey(encoded string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, errors.New("service account private key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("service account private key is not an RSA key")
+	}
+	return key, nil
+}
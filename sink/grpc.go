@@ -0,0 +1,325 @@
+package sink
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// Full method name of the bidirectional stream opened against the collector.
+//
+// Messages are JSON encoded (content-type application/grpc+json) so collectors
+// don't need generated stubs. The extension sends batches
+//
+//	{"seq": 1, "group": "/aws/lambda/fn", "entries": [{"time": 1700000000000, "message": "...", "level": "ERROR", "attributes": {...}}]}
+//
+// and the collector acknowledges them cumulatively with {"seq": 1}.
+const grpcStreamMethod = "/sst.extension.v1.Collector/Stream"
+
+const grpcConnectAttempts = 5
+
+var grpcStreamDesc = &grpc.StreamDesc{
+	StreamName:    "Stream",
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+type GRPCOptions struct {
+	// Address of the collector, e.g. collector.internal:4317
+	Endpoint string
+	// Disables TLS, for collectors reachable inside the VPC only
+	Insecure bool
+	// Sent as a bearer token in the authorization metadata when set
+	Token string
+	// Maximum number of batches sent but not yet acknowledged by the collector
+	Window int
+}
+
+// Streams batches to a user provided collector over a single long lived gRPC stream.
+// A write returns once the collector acknowledged its batch, batches that were sent but
+// not acknowledged are resent after a reconnect, so delivery is at-least-once and
+// collectors should dedupe on seq.
+type GRPC struct {
+	conn    *grpc.ClientConn
+	headers metadata.MD
+	slots   chan struct{}
+
+	// Serializes sending on the stream, which may block on flow control. Taken before mu.
+	send sync.Mutex
+
+	mu     sync.Mutex
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+	// Closed when the current stream breaks, so writes waiting for an ack reconnect
+	broken  chan struct{}
+	closed  bool
+	seq     uint64
+	pending []*grpcBatch
+}
+
+type grpcEntry struct {
+	Time       int64             `json:"time"`
+	Message    string            `json:"message"`
+	Level      string            `json:"level,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+type grpcBatch struct {
+	Seq     uint64      `json:"seq"`
+	Group   string      `json:"group"`
+	Entries []grpcEntry `json:"entries"`
+	// Closed once the collector acknowledged the batch
+	acked chan struct{}
+}
+
+type grpcAck struct {
+	Seq uint64 `json:"seq"`
+}
+
+type grpcJSONCodec struct{}
+
+func (grpcJSONCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (grpcJSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (grpcJSONCodec) Name() string                               { return "json" }
+
+func NewGRPC(options GRPCOptions) (*GRPC, error) {
+	if options.Window <= 0 {
+		options.Window = 16
+	}
+
+	creds := credentials.NewTLS(&tls.Config{})
+	if options.Insecure {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.Dial(
+		options.Endpoint,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(grpcJSONCodec{})),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := metadata.MD{}
+	if options.Token != "" {
+		headers.Set("authorization", "Bearer "+options.Token)
+	}
+
+	return &GRPC{
+		conn:    conn,
+		headers: headers,
+		slots:   make(chan struct{}, options.Window),
+	}, nil
+}
+
+// Sends the batch on the stream and waits for the collector to acknowledge it. Blocks
+// while the window of unacknowledged batches is full.
+func (g *GRPC) Write(ctx context.Context, batch *Batch) error {
+	select {
+	case g.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	msg := &grpcBatch{
+		Group:   batch.Group,
+		Entries: make([]grpcEntry, 0, len(batch.Entries)),
+		acked:   make(chan struct{}),
+	}
+	for _, entry := range batch.Entries {
+		msg.Entries = append(msg.Entries, grpcEntry{
+			Time:       entry.Time.UnixMilli(),
+			Message:    entry.Message,
+			Level:      entry.Level,
+			Attributes: entry.Attributes,
+		})
+	}
+
+	g.send.Lock()
+	g.mu.Lock()
+	g.seq++
+	msg.Seq = g.seq
+	g.pending = append(g.pending, msg)
+	stream, broken := g.stream, g.broken
+	g.mu.Unlock()
+	if stream != nil {
+		if err := stream.SendMsg(msg); err != nil {
+			log.Println("[grpc:Write] Stream broken, reconnecting")
+			g.mu.Lock()
+			if g.stream == stream {
+				g.reset()
+			}
+			g.mu.Unlock()
+			stream = nil
+		}
+	}
+	if stream == nil {
+		// A fresh stream resends everything pending, including this batch
+		var err error
+		if broken, err = g.connect(ctx); err != nil {
+			g.send.Unlock()
+			g.abandon(msg)
+			return err
+		}
+	}
+	g.send.Unlock()
+
+	for {
+		select {
+		case <-msg.acked:
+			return nil
+		case <-ctx.Done():
+			g.abandon(msg)
+			return ctx.Err()
+		case <-broken:
+		}
+		// The stream broke before the ack, the batch goes out again on a new one
+		g.send.Lock()
+		g.mu.Lock()
+		stream, broken = g.stream, g.broken
+		g.mu.Unlock()
+		if stream == nil {
+			var err error
+			if broken, err = g.connect(ctx); err != nil {
+				g.send.Unlock()
+				g.abandon(msg)
+				return err
+			}
+		}
+		g.send.Unlock()
+	}
+}
+
+// Gives up on a batch that wasn't acknowledged, the caller keeps it for a later write
+func (g *GRPC) abandon(msg *grpcBatch) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, pending := range g.pending {
+		if pending == msg {
+			g.pending = append(g.pending[:i:i], g.pending[i+1:]...)
+			<-g.slots
+			return
+		}
+	}
+}
+
+// Closes the stream and the underlying connection. Writes still waiting for an ack fail,
+// leaving their batches to the caller.
+func (g *GRPC) Close() error {
+	g.send.Lock()
+	g.mu.Lock()
+	g.closed = true
+	if g.stream != nil {
+		_ = g.stream.CloseSend()
+	}
+	g.reset()
+	g.mu.Unlock()
+	g.send.Unlock()
+	return g.conn.Close()
+}
+
+// Opens a new stream, retrying with backoff, and resends pending batches. Returns the
+// channel closed when it breaks. Must hold send.
+func (g *GRPC) connect(ctx context.Context) (chan struct{}, error) {
+	backoff := 100 * time.Millisecond
+	var err error
+	for attempt := 0; attempt < grpcConnectAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, errors.Join(err, ctx.Err())
+			}
+			backoff *= 2
+		}
+		var broken chan struct{}
+		broken, err = g.open()
+		if err == nil {
+			return broken, nil
+		}
+		log.Println("[grpc:connect] Failed to open stream:", err)
+	}
+	return nil, err
+}
+
+func (g *GRPC) open() (chan struct{}, error) {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return nil, errors.New("grpc sink is closed")
+	}
+	pending := append([]*grpcBatch{}, g.pending...)
+	g.mu.Unlock()
+
+	// The stream outlives the write that opened it, so it can't use the caller's context
+	ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(context.Background(), g.headers))
+	stream, err := g.conn.NewStream(ctx, grpcStreamDesc, grpcStreamMethod)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for _, msg := range pending {
+		if err := stream.SendMsg(msg); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	broken := make(chan struct{})
+	g.mu.Lock()
+	g.stream = stream
+	g.cancel = cancel
+	g.broken = broken
+	g.mu.Unlock()
+	go g.receive(stream)
+	return broken, nil
+}
+
+// Releases window slots as the collector acknowledges batches
+func (g *GRPC) receive(stream grpc.ClientStream) {
+	for {
+		var ack grpcAck
+		err := stream.RecvMsg(&ack)
+		g.mu.Lock()
+		if err != nil {
+			if g.stream == stream {
+				log.Println("[grpc:receive] Stream closed:", err)
+				g.reset()
+			}
+			g.mu.Unlock()
+			return
+		}
+		acked := 0
+		for acked < len(g.pending) && g.pending[acked].Seq <= ack.Seq {
+			close(g.pending[acked].acked)
+			acked++
+		}
+		g.pending = g.pending[acked:]
+		g.mu.Unlock()
+		for i := 0; i < acked; i++ {
+			<-g.slots
+		}
+	}
+}
+
+// Drops the current stream, waking the writes waiting on it. Must hold mu.
+func (g *GRPC) reset() {
+	if g.cancel != nil {
+		g.cancel()
+	}
+	if g.broken != nil {
+		close(g.broken)
+	}
+	g.stream = nil
+	g.cancel = nil
+	g.broken = nil
+}
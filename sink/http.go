@@ -0,0 +1,47 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Encodes one JSON document per line
+func encodeNDJSON[T any](docs []T) ([]byte, error) {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, doc := range docs {
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	return body.Bytes(), nil
+}
+
+// Posts a body, with a bearer token when set, and treats any non 2xx response as a failure
+func post(ctx context.Context, client *http.Client, url string, contentType string, token string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%s failed: %d[%s] %s", url, res.StatusCode, res.Status, string(msg))
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	return nil
+}
@@ -0,0 +1,125 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Throttled rates never drop below this fraction of the target
+const pacerFloor = 1.0 / 16
+
+// Spaces out calls so the sandboxes of a function together stay under an account
+// quota. Each sandbox targets its share of the quota, halves its rate when throttled
+// and recovers gradually. The state is kept in a token file, so a restarted extension
+// resumes at the rate it had backed off to instead of hammering the API again. The file
+// is written when the rate changes and on Close, not on every call.
+type Pacer struct {
+	mu     sync.Mutex
+	target float64
+	state  pacerState
+	path   string
+}
+
+type pacerState struct {
+	// Calls per second currently allowed
+	Rate   float64   `json:"rate"`
+	Tokens float64   `json:"tokens"`
+	Last   time.Time `json:"last"`
+}
+
+type PacerOptions struct {
+	// Calls per second allowed for the whole account and region
+	AccountTPS int
+	// Sandboxes expected to share the quota
+	Sandboxes int
+	// Token file, empty keeps the state in memory only
+	Path string
+}
+
+func NewPacer(options PacerOptions) *Pacer {
+	target := float64(options.AccountTPS) / float64(max(options.Sandboxes, 1))
+	p := &Pacer{
+		target: target,
+		path:   options.Path,
+		state:  pacerState{Rate: target, Tokens: 1},
+	}
+	if data, err := os.ReadFile(p.path); err == nil {
+		var saved pacerState
+		if json.Unmarshal(data, &saved) == nil && saved.Rate > 0 {
+			p.state = saved
+			p.state.Rate = min(saved.Rate, target)
+		}
+	}
+	return p
+}
+
+// Blocks until the next call is allowed or the context is done
+func (p *Pacer) Wait(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	if !p.state.Last.IsZero() {
+		// At most one call of burst, so the sandboxes can't line up
+		p.state.Tokens = min(1, p.state.Tokens+now.Sub(p.state.Last).Seconds()*p.state.Rate)
+	}
+	p.state.Last = now
+	delay := time.Duration(0)
+	if p.state.Tokens < 1 {
+		delay = time.Duration((1 - p.state.Tokens) / p.state.Rate * float64(time.Second))
+	}
+	p.state.Tokens--
+	p.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Backs off after the API reported throttling
+func (p *Pacer) Throttled() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.Rate = max(p.state.Rate/2, p.target*pacerFloor)
+	p.save()
+}
+
+// Recovers a little of the target rate after a successful call
+func (p *Pacer) Succeeded() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state.Rate >= p.target {
+		return
+	}
+	p.state.Rate = min(p.state.Rate+p.target*pacerFloor, p.target)
+	p.save()
+}
+
+// Saves the state, so the next extension starts with the tokens spent so far
+func (p *Pacer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.save()
+	return nil
+}
+
+func (p *Pacer) save() {
+	if p.path == "" {
+		return
+	}
+	data, _ := json.Marshal(p.state)
+	// Best effort, losing the file only loses the backoff
+	tmp := p.path + ".tmp"
+	if os.WriteFile(tmp, data, 0o600) == nil {
+		os.Rename(tmp, p.path)
+	}
+}
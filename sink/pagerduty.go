@@ -0,0 +1,119 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Triggers PagerDuty incidents through the Events API v2.
+// Alerts for the same function and error signature share a dedup key, so repeated
+// failures update one open incident instead of paging again.
+type PagerDuty struct {
+	httpClient *http.Client
+	url        string
+	routingKey string
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     pagerDutyPayload `json:"payload"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Component     string                 `json:"component,omitempty"`
+	Class         string                 `json:"class,omitempty"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+func NewPagerDuty(routingKey string) *PagerDuty {
+	return &PagerDuty{
+		httpClient: &http.Client{},
+		url:        pagerDutyEventsURL,
+		routingKey: routingKey,
+	}
+}
+
+func (p *PagerDuty) Alert(ctx context.Context, alert *Alert) error {
+	functionName := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	signature := alert.Fingerprint
+	if signature == "" {
+		signature = alert.Detail
+	}
+	sum := sha256.Sum256([]byte(functionName + "\n" + string(alert.Reason) + "\n" + signature))
+
+	severity := "critical"
+	if alert.Reason == AlertError {
+		severity = "error"
+	}
+	summary := fmt.Sprintf("%s: %s", functionName, alert.Reason)
+	if alert.Detail != "" {
+		summary = fmt.Sprintf("%s (%s)", summary, alert.Detail)
+	}
+	// The Events API rejects summaries longer than 1024 characters
+	if len(summary) > 1024 {
+		summary = summary[:1024]
+	}
+
+	details := map[string]interface{}{
+		"region": os.Getenv("AWS_REGION"),
+	}
+	if alert.RequestID != "" {
+		details["requestId"] = alert.RequestID
+	}
+	if alert.Group != "" {
+		details["logGroup"] = alert.Group
+	}
+	if alert.Fingerprint != "" {
+		details["fingerprint"] = alert.Fingerprint
+	}
+	if len(alert.Lines) > 0 {
+		details["lines"] = alert.Lines
+	}
+
+	body, err := json.Marshal(&pagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: "trigger",
+		DedupKey:    hex.EncodeToString(sum[:16]),
+		Payload: pagerDutyPayload{
+			Summary:       summary,
+			Source:        functionName,
+			Severity:      severity,
+			Component:     "lambda",
+			Class:         string(alert.Reason),
+			CustomDetails: details,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%s failed: %d[%s] %s", p.url, res.StatusCode, res.Status, string(msg))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Ships batches to a Quickwit index through its NDJSON ingest API.
+// The index should have a datetime field named timestamp.
+type Quickwit struct {
+	httpClient *http.Client
+	url        string
+	token      string
+}
+
+type QuickwitOptions struct {
+	// Base URL of the Quickwit cluster, e.g. http://quickwit.internal:7280
+	Endpoint string
+	// Index the documents are ingested into
+	Index string
+	// Optional bearer token, for clusters behind an authenticating proxy
+	Token string
+}
+
+type quickwitDoc struct {
+	Timestamp  string            `json:"timestamp"`
+	Group      string            `json:"group"`
+	Message    string            `json:"message"`
+	Level      string            `json:"level,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+func NewQuickwit(options QuickwitOptions) *Quickwit {
+	return &Quickwit{
+		httpClient: &http.Client{},
+		url:        fmt.Sprintf("%s/api/v1/%s/ingest", strings.TrimSuffix(options.Endpoint, "/"), options.Index),
+		token:      options.Token,
+	}
+}
+
+// The ingest API rejects payloads over 10MB by default
+var quickwitLimits = Limits{MaxBytes: 9 * 1024 * 1024, EntryOverhead: 128}
+
+func (q *Quickwit) Write(ctx context.Context, batch *Batch) error {
+	return writeChunked(batch, quickwitLimits, func(entries []Entry) error {
+		return q.write(ctx, batch.Group, entries)
+	})
+}
+
+func (q *Quickwit) write(ctx context.Context, group string, entries []Entry) error {
+	docs := make([]quickwitDoc, 0, len(entries))
+	for _, entry := range entries {
+		docs = append(docs, quickwitDoc{
+			Timestamp:  entry.Time.UTC().Format(time.RFC3339Nano),
+			Group:      group,
+			Message:    entry.Message,
+			Level:      entry.Level,
+			Attributes: entry.Attributes,
+		})
+	}
+	body, err := encodeNDJSON(docs)
+	if err != nil {
+		return err
+	}
+	return post(ctx, q.httpClient, q.url, "application/x-ndjson", q.token, body)
+}
@@ -0,0 +1,145 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Object format written by the S3 sink
+type S3Format string
+
+const (
+	// Gzip compressed newline delimited JSON
+	S3FormatJSON S3Format = "json"
+	// Snappy compressed Parquet with a fixed schema, queryable by Athena as is
+	S3FormatParquet S3Format = "parquet"
+)
+
+type S3Options struct {
+	Bucket string
+	// Prepended to every object key, e.g. logs/
+	Prefix string
+	Format S3Format
+}
+
+// Writes every batch as one object, partitioned by function and hour:
+//
+//	{prefix}{functionName}/year=2024/month=01/day=02/hour=03/{unix ms}-{uuid}.{ext}
+type S3 struct {
+	client  *s3.Client
+	options S3Options
+}
+
+// Row of the fixed Parquet schema. The same field names are used for JSON objects.
+type s3Row struct {
+	Timestamp  int64             `parquet:"timestamp,timestamp(millisecond)" json:"timestamp"`
+	Level      string            `parquet:"level,dict" json:"level"`
+	RequestID  string            `parquet:"requestId,dict" json:"requestId"`
+	Message    string            `parquet:"message" json:"message"`
+	Attributes map[string]string `parquet:"attributes" json:"attributes"`
+}
+
+func NewS3(client *s3.Client, options S3Options) *S3 {
+	if options.Format == "" {
+		options.Format = S3FormatJSON
+	}
+	return &S3{
+		client:  client,
+		options: options,
+	}
+}
+
+func (s *S3) Write(ctx context.Context, batch *Batch) error {
+	if len(batch.Entries) == 0 {
+		return nil
+	}
+
+	rows := make([]s3Row, 0, len(batch.Entries))
+	for _, entry := range batch.Entries {
+		rows = append(rows, s3Row{
+			Timestamp:  entry.Time.UnixMilli(),
+			Level:      entry.Level,
+			RequestID:  batch.RequestID,
+			Message:    entry.Message,
+			Attributes: entry.Attributes,
+		})
+	}
+
+	var body []byte
+	var err error
+	var extension, contentType, contentEncoding string
+	switch s.options.Format {
+	case S3FormatParquet:
+		body, err = encodeParquet(rows)
+		extension, contentType = "parquet", "application/vnd.apache.parquet"
+	default:
+		body, err = encodeGzipNDJSON(rows)
+		extension, contentType, contentEncoding = "json.gz", "application/x-ndjson", "gzip"
+	}
+	if err != nil {
+		return err
+	}
+
+	put := &s3.PutObjectInput{
+		Bucket:      aws.String(s.options.Bucket),
+		Key:         aws.String(s.key(batch.Entries[0].Time, extension)),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(contentType),
+	}
+	if contentEncoding != "" {
+		put.ContentEncoding = aws.String(contentEncoding)
+	}
+	_, err = s.client.PutObject(ctx, put)
+	return err
+}
+
+func (s *S3) key(t time.Time, extension string) string {
+	t = t.UTC()
+	return fmt.Sprintf(
+		"%s%s/year=%04d/month=%02d/day=%02d/hour=%02d/%d-%s.%s",
+		s.options.Prefix,
+		strings.Trim(os.Getenv("AWS_LAMBDA_FUNCTION_NAME"), "/"),
+		t.Year(), t.Month(), t.Day(), t.Hour(),
+		t.UnixMilli(),
+		uuid.New().String(),
+		extension,
+	)
+}
+
+func encodeParquet(rows []s3Row) ([]byte, error) {
+	var body bytes.Buffer
+	writer := parquet.NewGenericWriter[s3Row](&body, parquet.Compression(&parquet.Snappy))
+	if _, err := writer.Write(rows); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+func encodeGzipNDJSON(rows []s3Row) ([]byte, error) {
+	lines, err := encodeNDJSON(rows)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	if _, err := writer.Write(lines); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
@@ -0,0 +1,100 @@
+//go:build integration
+
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/parquet-go/parquet-go"
+)
+
+func localstackS3(t *testing.T) (*s3.Client, string) {
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(localstackEndpoint()),
+		Credentials:  localstackCredentials,
+		UsePathStyle: true,
+	})
+	bucket := fmt.Sprintf("sst-integration-%d", time.Now().UnixNano())
+	_, err := client.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	return client, bucket
+}
+
+// Reads back the only object written to the bucket
+func readObject(t *testing.T, client *s3.Client, bucket string) (string, []byte) {
+	list, err := client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+	if err != nil {
+		t.Fatalf("ListObjectsV2: %v", err)
+	}
+	if len(list.Contents) != 1 {
+		t.Fatalf("expected 1 object, got %d", len(list.Contents))
+	}
+	key := aws.ToString(list.Contents[0].Key)
+	out, err := client.GetObject(context.Background(), &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	defer out.Body.Close()
+	body, err := io.ReadAll(out.Body)
+	if err != nil {
+		t.Fatalf("reading %s: %v", key, err)
+	}
+	return key, body
+}
+
+func TestS3WritesGzipNDJSON(t *testing.T) {
+	client, bucket := localstackS3(t)
+	s := NewS3(client, S3Options{Bucket: bucket, Prefix: "logs/", Format: S3FormatJSON})
+
+	err := s.Write(context.Background(), batch("/aws/lambda/fn", "one", "two"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	key, body := readObject(t, client, bucket)
+	if !strings.HasPrefix(key, "logs/") || !strings.HasSuffix(key, ".json.gz") {
+		t.Fatalf("unexpected key %s", key)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	lines, _ := io.ReadAll(reader)
+	if n := strings.Count(string(lines), "\n"); n != 2 {
+		t.Fatalf("expected 2 lines, got %d", n)
+	}
+}
+
+func TestS3WritesParquet(t *testing.T) {
+	client, bucket := localstackS3(t)
+	s := NewS3(client, S3Options{Bucket: bucket, Format: S3FormatParquet})
+
+	err := s.Write(context.Background(), batch("/aws/lambda/fn", "one", "two"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	key, body := readObject(t, client, bucket)
+	if !strings.HasSuffix(key, ".parquet") {
+		t.Fatalf("unexpected key %s", key)
+	}
+	rows, err := parquet.Read[s3Row](bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("parquet: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Message != "one" || rows[1].Message != "two" {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+}
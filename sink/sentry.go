@@ -0,0 +1,195 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sst/extension/processor"
+)
+
+type SentryOptions struct {
+	// Project DSN, https://<public key>@<host>/<project id>
+	DSN         string
+	Release     string
+	Environment string
+}
+
+// Converts error records carrying a stack trace into Sentry events, sent with the
+// envelope protocol. Batches without errors are skipped.
+type Sentry struct {
+	httpClient  *http.Client
+	dsn         string
+	url         string
+	auth        string
+	release     string
+	environment string
+}
+
+type sentryFrame struct {
+	Function string `json:"function,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Lineno   int    `json:"lineno,omitempty"`
+	Colno    int    `json:"colno,omitempty"`
+	InApp    bool   `json:"in_app"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   float64           `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Fingerprint []string          `json:"fingerprint,omitempty"`
+	Tags        map[string]string `json:"tags"`
+	Exception   struct {
+		Values []sentryException `json:"values"`
+	} `json:"exception"`
+	Extra map[string]string `json:"extra,omitempty"`
+}
+
+func NewSentry(options SentryOptions) (*Sentry, error) {
+	dsn, err := url.Parse(options.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sentry DSN: %w", err)
+	}
+	projectID := strings.Trim(dsn.Path, "/")
+	if dsn.User == nil || projectID == "" {
+		return nil, errors.New("invalid sentry DSN: expected https://<public key>@<host>/<project id>")
+	}
+	return &Sentry{
+		httpClient:  &http.Client{},
+		dsn:         options.DSN,
+		url:         fmt.Sprintf("%s://%s/api/%s/envelope/", dsn.Scheme, dsn.Host, projectID),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=sst-extension/1.0, sentry_key=%s", dsn.User.Username()),
+		release:     options.Release,
+		environment: options.Environment,
+	}, nil
+}
+
+func (s *Sentry) Write(ctx context.Context, batch *Batch) error {
+	var errs []error
+	for _, entry := range batch.Entries {
+		if entry.Level != "ERROR" && entry.Level != "FATAL" && entry.Attributes["fingerprint"] == "" {
+			continue
+		}
+		exception := processor.ParseException(entry.Message)
+		if exception == nil {
+			continue
+		}
+		if err := s.send(ctx, s.event(batch, entry, exception)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Sentry) event(batch *Batch, entry Entry, exception *processor.Exception) *sentryEvent {
+	level := "error"
+	if entry.Level == "FATAL" {
+		level = "fatal"
+	}
+	event := &sentryEvent{
+		EventID:     strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Timestamp:   float64(entry.Time.UnixMilli()) / 1000,
+		Platform:    "other",
+		Level:       level,
+		Logger:      "lambda",
+		ServerName:  os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+		Release:     s.release,
+		Environment: s.environment,
+		Tags: map[string]string{
+			"function":  os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+			"region":    os.Getenv("AWS_REGION"),
+			"logGroup":  batch.Group,
+			"requestId": batch.RequestID,
+		},
+		Extra: entry.Attributes,
+	}
+	if fingerprint := entry.Attributes["fingerprint"]; fingerprint != "" {
+		event.Fingerprint = []string{fingerprint}
+	}
+
+	value := sentryException{
+		Type:  exception.Type,
+		Value: exception.Message,
+	}
+	if len(exception.Frames) > 0 {
+		// Sentry expects the outermost call first
+		frames := make([]sentryFrame, 0, len(exception.Frames))
+		for i := len(exception.Frames) - 1; i >= 0; i-- {
+			frame := exception.Frames[i]
+			frames = append(frames, sentryFrame{
+				Function: frame.Function,
+				Filename: frame.File,
+				Lineno:   frame.Line,
+				Colno:    frame.Column,
+				InApp:    !strings.Contains(frame.File, "/var/runtime/") && !strings.Contains(frame.File, "node_modules") && !strings.HasPrefix(frame.File, "node:"),
+			})
+		}
+		value.Stacktrace = &sentryStacktrace{Frames: frames}
+	}
+	event.Exception.Values = []sentryException{value}
+	return event
+}
+
+func (s *Sentry) send(ctx context.Context, event *sentryEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	header, _ := json.Marshal(map[string]string{
+		"event_id": event.EventID,
+		"dsn":      s.dsn,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339),
+	})
+	item, _ := json.Marshal(map[string]interface{}{
+		"type":   "event",
+		"length": len(payload),
+	})
+
+	var body bytes.Buffer
+	body.Write(header)
+	body.WriteByte('\n')
+	body.Write(item)
+	body.WriteByte('\n')
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%s failed: %d[%s]", s.url, res.StatusCode, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+type SESOptions struct {
+	// Verified SES identity the digest is sent from
+	From string
+	// Recipients of the digest
+	To []string
+	// Minimum time between two emails from the same sandbox. Alerts raised in between
+	// are counted and reported in the next email.
+	MinInterval time.Duration
+}
+
+// Emails a digest through SES when an invocation crashes, times out, or the extension fails
+type SES struct {
+	client  *sesv2.Client
+	options SESOptions
+
+	mu         sync.Mutex
+	lastSent   time.Time
+	suppressed int
+}
+
+func NewSES(client *sesv2.Client, options SESOptions) *SES {
+	return &SES{
+		client:  client,
+		options: options,
+	}
+}
+
+func (s *SES) Alert(ctx context.Context, alert *Alert) error {
+	s.mu.Lock()
+	if !s.lastSent.IsZero() && time.Since(s.lastSent) < s.options.MinInterval {
+		s.suppressed++
+		s.mu.Unlock()
+		return nil
+	}
+	suppressed := s.suppressed
+	s.suppressed = 0
+	s.lastSent = time.Now()
+	s.mu.Unlock()
+
+	functionName := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	subject := fmt.Sprintf("[sst] %s: %s", functionName, alert.Reason)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Function: %s\n", functionName)
+	fmt.Fprintf(&body, "Region: %s\n", os.Getenv("AWS_REGION"))
+	fmt.Fprintf(&body, "Reason: %s\n", alert.Reason)
+	if alert.RequestID != "" {
+		fmt.Fprintf(&body, "RequestId: %s\n", alert.RequestID)
+	}
+	if alert.Group != "" {
+		fmt.Fprintf(&body, "Log group: %s\n", alert.Group)
+	}
+	if alert.Detail != "" {
+		fmt.Fprintf(&body, "Detail: %s\n", alert.Detail)
+	}
+	if suppressed > 0 {
+		fmt.Fprintf(&body, "\n%d more alerts were raised since the last email.\n", suppressed)
+	}
+	if len(alert.Lines) > 0 {
+		body.WriteString("\nLast log lines:\n\n")
+		for _, line := range alert.Lines {
+			body.WriteString(line)
+			body.WriteString("\n")
+		}
+	}
+
+	_, err := s.client.SendEmail(ctx, &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(s.options.From),
+		Destination: &types.Destination{
+			ToAddresses: s.options.To,
+		},
+		Content: &types.EmailContent{
+			Simple: &types.Message{
+				Subject: &types.Content{Data: aws.String(subject)},
+				Body: &types.Body{
+					Text: &types.Content{Data: aws.String(body.String())},
+				},
+			},
+		},
+	})
+	return err
+}
@@ -0,0 +1,33 @@
+package sink
+
+import (
+	"context"
+	"time"
+)
+
+// A single log line headed for a destination
+type Entry struct {
+	Time    time.Time
+	Message string
+	// Severity detected on the line, empty when it has none
+	Level string
+	// Structured fields attached to the line by the pipeline
+	Attributes map[string]string
+}
+
+// A group of entries flushed together to one log group
+type Batch struct {
+	Group string
+	// Log stream within the group, empty for the sink's own
+	Stream string
+	// Days the group keeps events, set on the group before writing. 0 leaves it as it is
+	Retention int
+	// The invocation the entries belong to
+	RequestID string
+	Entries   []Entry
+}
+
+// A destination that flushed batches are delivered to
+type Sink interface {
+	Write(ctx context.Context, batch *Batch) error
+}
@@ -0,0 +1,63 @@
+package sink
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Trace the invocation belongs to, as carried by the X-Amzn-Trace-Id header
+type TraceContext struct {
+	TraceID  string
+	ParentID string
+	Sampled  bool
+}
+
+// Parses a tracing header such as Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1
+func ParseTraceHeader(value string) (TraceContext, bool) {
+	trace := TraceContext{}
+	for _, part := range strings.Split(value, ";") {
+		key, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "Root":
+			trace.TraceID = val
+		case "Parent":
+			trace.ParentID = val
+		case "Sampled":
+			trace.Sampled = val == "1"
+		}
+	}
+	return trace, trace.TraceID != ""
+}
+
+// A timed operation within an invocation's trace
+type Span struct {
+	Trace TraceContext
+	// Generated when left empty
+	ID    string
+	Name  string
+	Start time.Time
+	End   time.Time
+	// The operation failed because of the caller or the function itself
+	Error bool
+	Fault bool
+	// Indexed key/value pairs
+	Annotations map[string]string
+	// Free form data attached to the span
+	Metadata map[string]interface{}
+}
+
+// Generates the 64-bit identifier of a span, for spans that need to be referred to as
+// the parent of others
+func NewSpanID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// A destination for spans, as opposed to log batches
+type SpanSink interface {
+	WriteSpans(ctx context.Context, spans []Span) error
+}
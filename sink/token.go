@@ -0,0 +1,70 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tokens are refreshed this long before they expire
+const tokenRefreshMargin = time.Minute
+
+// Caches an OAuth access token until shortly before it expires
+type tokenCache struct {
+	fetch func(ctx context.Context) (string, time.Duration, error)
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func (c *tokenCache) Get(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expiry) {
+		return c.token, nil
+	}
+	token, ttl, err := c.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token = token
+	c.expiry = time.Now().Add(ttl - tokenRefreshMargin)
+	return token, nil
+}
+
+// Performs an OAuth token request with a form encoded body
+func requestToken(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (string, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("%s failed: %d[%s] %s", tokenURL, res.StatusCode, res.Status, string(body))
+	}
+
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", 0, err
+	}
+	return out.AccessToken, time.Duration(out.ExpiresIn) * time.Second, nil
+}
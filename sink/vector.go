@@ -0,0 +1,98 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Ships batches as Vector native JSON log events. Endpoints are either an http_server
+// source, http(s)://host:port/path, or a socket source in tcp mode, tcp://host:port.
+// Both sources should use the native_json codec with newline_delimited framing.
+type Vector struct {
+	httpClient *http.Client
+	endpoint   *url.URL
+	token      string
+}
+
+type VectorOptions struct {
+	// http(s):// or tcp:// address of the Vector source
+	Endpoint string
+	// Optional bearer token, for HTTP sources behind an authenticating proxy
+	Token string
+}
+
+type vectorLog struct {
+	Message    string            `json:"message"`
+	Timestamp  string            `json:"timestamp"`
+	Level      string            `json:"level,omitempty"`
+	Group      string            `json:"group"`
+	RequestID  string            `json:"request_id,omitempty"`
+	Function   string            `json:"function"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Native event envelope, only log events are produced
+type vectorEvent struct {
+	Log vectorLog `json:"log"`
+}
+
+func NewVector(options VectorOptions) (*Vector, error) {
+	endpoint, err := url.Parse(options.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vector endpoint: %w", err)
+	}
+	switch endpoint.Scheme {
+	case "http", "https", "tcp":
+	default:
+		return nil, fmt.Errorf("invalid vector endpoint %q: expected http, https or tcp scheme", options.Endpoint)
+	}
+	return &Vector{
+		httpClient: &http.Client{},
+		endpoint:   endpoint,
+		token:      options.Token,
+	}, nil
+}
+
+func (v *Vector) Write(ctx context.Context, batch *Batch) error {
+	function := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	events := make([]vectorEvent, 0, len(batch.Entries))
+	for _, entry := range batch.Entries {
+		events = append(events, vectorEvent{Log: vectorLog{
+			Message:    entry.Message,
+			Timestamp:  entry.Time.UTC().Format(time.RFC3339Nano),
+			Level:      entry.Level,
+			Group:      batch.Group,
+			RequestID:  batch.RequestID,
+			Function:   function,
+			Attributes: entry.Attributes,
+		}})
+	}
+	body, err := encodeNDJSON(events)
+	if err != nil {
+		return err
+	}
+	if v.endpoint.Scheme == "tcp" {
+		return v.send(ctx, body)
+	}
+	return post(ctx, v.httpClient, v.endpoint.String(), "application/x-ndjson", v.token, body)
+}
+
+// Writes the events over a fresh connection, Vector has no acknowledgements on raw sockets
+func (v *Vector) send(ctx context.Context, body []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", v.endpoint.Host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetWriteDeadline(deadline)
+	}
+	_, err = conn.Write(body)
+	return err
+}
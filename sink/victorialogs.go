@@ -0,0 +1,57 @@
+package sink
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Ships batches to VictoriaLogs through its JSON lines ingest API.
+// Each log group becomes its own log stream.
+type VictoriaLogs struct {
+	httpClient *http.Client
+	url        string
+	token      string
+}
+
+type VictoriaLogsOptions struct {
+	// Base URL of the VictoriaLogs instance, e.g. http://victorialogs.internal:9428
+	Endpoint string
+	// Optional bearer token, for instances behind an authenticating proxy
+	Token string
+}
+
+type victoriaLogsDoc struct {
+	Time       string            `json:"_time"`
+	Message    string            `json:"_msg"`
+	Group      string            `json:"group"`
+	Level      string            `json:"level,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+func NewVictoriaLogs(options VictoriaLogsOptions) *VictoriaLogs {
+	return &VictoriaLogs{
+		httpClient: &http.Client{},
+		url:        strings.TrimSuffix(options.Endpoint, "/") + "/insert/jsonline?_stream_fields=group",
+		token:      options.Token,
+	}
+}
+
+func (v *VictoriaLogs) Write(ctx context.Context, batch *Batch) error {
+	docs := make([]victoriaLogsDoc, 0, len(batch.Entries))
+	for _, entry := range batch.Entries {
+		docs = append(docs, victoriaLogsDoc{
+			Time:       entry.Time.UTC().Format(time.RFC3339Nano),
+			Message:    entry.Message,
+			Group:      batch.Group,
+			Level:      entry.Level,
+			Attributes: entry.Attributes,
+		})
+	}
+	body, err := encodeNDJSON(docs)
+	if err != nil {
+		return err
+	}
+	return post(ctx, v.httpClient, v.url, "application/x-ndjson", v.token, body)
+}
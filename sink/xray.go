@@ -0,0 +1,191 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// How segments are submitted to X-Ray
+type XRayMode string
+
+const (
+	// Through the daemon Lambda runs next to the function, AWS_XRAY_DAEMON_ADDRESS
+	XRayUDP XRayMode = "udp"
+	// Through the PutTraceSegments API, when no daemon is reachable
+	XRayAPI XRayMode = "api"
+)
+
+const xrayDaemonHeader = `{"format": "json", "version": 1}` + "\n"
+
+// Annotation keys may only contain alphanumerics and underscores
+var xrayAnnotationKey = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+type XRayOptions struct {
+	Mode XRayMode
+	// Address of the daemon for XRayUDP
+	DaemonAddress string
+	// Credentials and region used to sign requests for XRayAPI
+	Config aws.Config
+}
+
+// Submits spans as X-Ray subsegments of the invocation's trace. Unsampled spans are dropped.
+type XRay struct {
+	options    XRayOptions
+	httpClient *http.Client
+	signer     *v4.Signer
+}
+
+type xraySubsegment struct {
+	Type        string                 `json:"type"`
+	ID          string                 `json:"id"`
+	TraceID     string                 `json:"trace_id"`
+	ParentID    string                 `json:"parent_id"`
+	Name        string                 `json:"name"`
+	StartTime   float64                `json:"start_time"`
+	EndTime     float64                `json:"end_time"`
+	Error       bool                   `json:"error,omitempty"`
+	Fault       bool                   `json:"fault,omitempty"`
+	Annotations map[string]string      `json:"annotations,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
+
+func NewXRay(options XRayOptions) *XRay {
+	if options.Mode == "" {
+		options.Mode = XRayUDP
+	}
+	if options.DaemonAddress == "" {
+		options.DaemonAddress = "127.0.0.1:2000"
+	}
+	return &XRay{
+		options:    options,
+		httpClient: &http.Client{},
+		signer:     v4.NewSigner(),
+	}
+}
+
+func (x *XRay) WriteSpans(ctx context.Context, spans []Span) error {
+	documents := []string{}
+	for _, span := range spans {
+		if !span.Trace.Sampled || span.Trace.TraceID == "" {
+			continue
+		}
+		document, err := json.Marshal(x.subsegment(span))
+		if err != nil {
+			return err
+		}
+		documents = append(documents, string(document))
+	}
+	if len(documents) == 0 {
+		return nil
+	}
+	if x.options.Mode == XRayAPI {
+		return x.put(ctx, documents)
+	}
+	return x.send(documents)
+}
+
+func (x *XRay) subsegment(span Span) *xraySubsegment {
+	id := span.ID
+	if id == "" {
+		id = NewSpanID()
+	}
+	annotations := map[string]string{}
+	for key, value := range span.Annotations {
+		annotations[xrayAnnotationKey.ReplaceAllString(key, "_")] = value
+	}
+	segment := &xraySubsegment{
+		Type:        "subsegment",
+		ID:          id,
+		TraceID:     span.Trace.TraceID,
+		ParentID:    span.Trace.ParentID,
+		Name:        span.Name,
+		StartTime:   epochSeconds(span.Start),
+		EndTime:     epochSeconds(span.End),
+		Error:       span.Error,
+		Fault:       span.Fault,
+		Annotations: annotations,
+	}
+	if len(span.Metadata) > 0 {
+		segment.Metadata = map[string]interface{}{"sst": span.Metadata}
+	}
+	return segment
+}
+
+// Sends each document to the daemon in its own datagram
+func (x *XRay) send(documents []string) error {
+	conn, err := net.Dial("udp", x.options.DaemonAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var errs []error
+	for _, document := range documents {
+		if _, err := conn.Write([]byte(xrayDaemonHeader + document)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Calls PutTraceSegments, signing the request with SigV4
+func (x *XRay) put(ctx context.Context, documents []string) error {
+	body, err := json.Marshal(map[string][]string{"TraceSegmentDocuments": documents})
+	if err != nil {
+		return err
+	}
+	region := x.options.Config.Region
+	url := fmt.Sprintf("https://xray.%s.amazonaws.com/TraceSegments", region)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	credentials, err := x.options.Config.Credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(body)
+	err = x.signer.SignHTTP(ctx, credentials, req, hex.EncodeToString(hash[:]), "xray", region, time.Now())
+	if err != nil {
+		return err
+	}
+
+	res, err := x.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s failed: %d[%s] %s", url, res.StatusCode, res.Status, string(msg))
+	}
+	var out struct {
+		UnprocessedTraceSegments []struct {
+			ErrorCode string `json:"ErrorCode"`
+			Message   string `json:"Message"`
+		} `json:"UnprocessedTraceSegments"`
+	}
+	if json.Unmarshal(msg, &out) == nil && len(out.UnprocessedTraceSegments) > 0 {
+		first := out.UnprocessedTraceSegments[0]
+		return fmt.Errorf("%d segments unprocessed: %s %s", len(out.UnprocessedTraceSegments), first.ErrorCode, first.Message)
+	}
+	return nil
+}
+
+func epochSeconds(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1e6
+}
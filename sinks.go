@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/sst/extension/api/retry"
+	"github.com/sst/extension/config"
+	"github.com/sst/extension/sink"
+	"github.com/sst/extension/summary"
+)
+
+// Everything telemetry is delivered to, built from the settings at init and again when
+// a reload changes them
+type sinkSet struct {
+	// Also receives the Application Signals metrics and names the sandbox's log stream
+	cloudWatch *sink.CloudWatch
+	sinks      []sink.Sink
+	// Name of each sink in the write-ahead log
+	consumers []string
+	// Sinks holding connections or buffers that are released on exit
+	closers    []io.Closer
+	spanSinks  []sink.SpanSink
+	alerters   []sink.Alerter
+	appSignals *sink.ApplicationSignals
+}
+
+// Builds the sinks, span sinks and alerters the settings enable. streamName is the log
+// stream of the sandbox.
+func buildSinks(cfg aws.Config, settings *config.Config, sandbox string, streamName string) (*sinkSet, error) {
+	cloudWatch := sink.NewCloudWatch(cloudwatchlogs.NewFromConfig(cloudWatchConfig(cfg, settings.CloudWatch)), streamName).WithRetry(retry.Policy{
+		MaxAttempts:  settings.CloudWatch.MaxAttempts,
+		InitialDelay: settings.Retry.InitialDelay,
+		MaxDelay:     settings.Retry.MaxDelay,
+	}).WithRotation(sink.Rotation{
+		MaxBytes: settings.CloudWatch.RotateBytes,
+		MaxAge:   settings.CloudWatch.RotateAge,
+		Daily:    true,
+		Name: func(at time.Time, rotated int) string {
+			return fmt.Sprintf("%s/%s-%d", at.Format("2006/01/02"), sandbox, rotated)
+		},
+	})
+	groupTags := map[string]string{}
+	for _, tag := range settings.CloudWatch.Tags {
+		key, value, _ := strings.Cut(tag, "=")
+		groupTags[key] = value
+	}
+	cloudWatch.WithGroupOptions(sink.GroupOptions{
+		RetentionDays: settings.CloudWatch.Retention,
+		Tags:          groupTags,
+		KMSKeyID:      settings.CloudWatch.KMSKey,
+	})
+	var pacer *sink.Pacer
+	if settings.CloudWatch.AccountTPS > 0 {
+		pacerPath := ""
+		if settings.Flush.SpillDir != "" {
+			pacerPath = filepath.Join(settings.Flush.SpillDir, "pacer.json")
+		}
+		pacer = sink.NewPacer(sink.PacerOptions{
+			AccountTPS: settings.CloudWatch.AccountTPS,
+			Sandboxes:  settings.CloudWatch.Sandboxes,
+			Path:       pacerPath,
+		})
+		cloudWatch.WithPacer(pacer)
+	}
+	if settings.CloudWatch.Entity {
+		cloudWatch.WithEntity(sink.LambdaEntity(settings.CloudWatch.Service, settings.CloudWatch.Environment, os.Getenv("AWS_LAMBDA_FUNCTION_NAME")))
+	}
+	set := &sinkSet{cloudWatch: cloudWatch, sinks: []sink.Sink{cloudWatch}}
+	if pacer != nil {
+		// Keeps the backoff for the next start
+		set.closers = append(set.closers, pacer)
+	}
+	if settings.CloudWatch.ApplicationSignals {
+		set.appSignals = &sink.ApplicationSignals{
+			Service:     settings.CloudWatch.Service,
+			Environment: settings.CloudWatch.Environment,
+			Operation:   os.Getenv("AWS_LAMBDA_FUNCTION_NAME") + "/FunctionHandler",
+		}
+	}
+	if settings.GRPC.Endpoint != "" {
+		grpcSink, err := sink.NewGRPC(sink.GRPCOptions{
+			Endpoint: settings.GRPC.Endpoint,
+			Insecure: settings.GRPC.Insecure,
+			Token:    settings.GRPC.Token,
+			Window:   settings.GRPC.Window,
+		})
+		if err != nil {
+			set.Close()
+			return nil, err
+		}
+		set.sinks = append(set.sinks, grpcSink)
+		set.closers = append(set.closers, grpcSink)
+	}
+	if settings.Quickwit.Endpoint != "" {
+		set.sinks = append(set.sinks, sink.NewQuickwit(sink.QuickwitOptions{
+			Endpoint: settings.Quickwit.Endpoint,
+			Index:    settings.Quickwit.Index,
+			Token:    settings.Quickwit.Token,
+		}))
+	}
+	if settings.VictoriaLogs.Endpoint != "" {
+		set.sinks = append(set.sinks, sink.NewVictoriaLogs(sink.VictoriaLogsOptions{
+			Endpoint: settings.VictoriaLogs.Endpoint,
+			Token:    settings.VictoriaLogs.Token,
+		}))
+	}
+	if settings.Vector.Endpoint != "" {
+		vectorSink, err := sink.NewVector(sink.VectorOptions{
+			Endpoint: settings.Vector.Endpoint,
+			Token:    settings.Vector.Token,
+		})
+		if err != nil {
+			set.Close()
+			return nil, err
+		}
+		set.sinks = append(set.sinks, vectorSink)
+	}
+	if settings.S3.Bucket != "" {
+		set.sinks = append(set.sinks, sink.NewS3(s3.NewFromConfig(cfg), sink.S3Options{
+			Bucket: settings.S3.Bucket,
+			Prefix: settings.S3.Prefix,
+			Format: sink.S3Format(settings.S3.Format),
+		}))
+	}
+	if settings.GCP.Credentials != "" {
+		gcpSink, err := sink.NewGCP(sink.GCPOptions{
+			Credentials: settings.GCP.Credentials,
+			ProjectID:   settings.GCP.ProjectID,
+			LogID:       settings.GCP.LogID,
+		})
+		if err != nil {
+			set.Close()
+			return nil, err
+		}
+		set.sinks = append(set.sinks, gcpSink)
+	}
+	if settings.Azure.Endpoint != "" {
+		set.sinks = append(set.sinks, sink.NewAzure(sink.AzureOptions{
+			Endpoint:     settings.Azure.Endpoint,
+			RuleID:       settings.Azure.RuleID,
+			Stream:       settings.Azure.Stream,
+			TenantID:     settings.Azure.TenantID,
+			ClientID:     settings.Azure.ClientID,
+			ClientSecret: settings.Azure.ClientSecret,
+		}))
+	}
+	if settings.Sentry.DSN != "" {
+		sentrySink, err := sink.NewSentry(sink.SentryOptions{
+			DSN:         settings.Sentry.DSN,
+			Release:     settings.Sentry.Release,
+			Environment: settings.Sentry.Environment,
+		})
+		if err != nil {
+			set.Close()
+			return nil, err
+		}
+		set.sinks = append(set.sinks, sentrySink)
+	}
+	if settings.XRay.Mode != "" {
+		set.spanSinks = append(set.spanSinks, sink.NewXRay(sink.XRayOptions{
+			Mode:          sink.XRayMode(settings.XRay.Mode),
+			DaemonAddress: settings.XRay.DaemonAddress,
+			Config:        cfg,
+		}))
+	}
+	if len(settings.SES.To) > 0 {
+		ses := sink.NewSES(sesv2.NewFromConfig(cfg), sink.SESOptions{
+			From:        settings.SES.From,
+			To:          settings.SES.To,
+			MinInterval: settings.SES.MinInterval,
+		})
+		set.alerters = append(set.alerters, sink.OnlyReasons(ses, sink.AlertTimeout, sink.AlertOutOfMemory, sink.AlertCrash, sink.AlertExtension))
+	}
+	if settings.PagerDuty.RoutingKey != "" {
+		reasons := []sink.AlertReason{}
+		for _, reason := range settings.PagerDuty.Reasons {
+			reasons = append(reasons, sink.AlertReason(reason))
+		}
+		set.alerters = append(set.alerters, sink.OnlyReasons(sink.NewPagerDuty(settings.PagerDuty.RoutingKey), reasons...))
+	}
+	set.consumers = consumerNames(set.sinks)
+	if settings.Summary.DedupeWindow > 0 {
+		for i := range set.sinks {
+			set.sinks[i] = sink.Dedupe(set.sinks[i], settings.Summary.DedupeWindow, func(entry sink.Entry) string {
+				return summary.Key(entry.Message)
+			})
+		}
+	}
+	return set, nil
+}
+
+// Releases the sinks holding connections or buffers
+func (s *sinkSet) Close() {
+	for _, closer := range s.closers {
+		if err := closer.Close(); err != nil {
+			log.Println("[main:sinks] Failed to close sink:", err)
+		}
+	}
+}
+
+// Reports whether the sinks built from two configurations differ
+func sinksChanged(current *config.Config, next *config.Config) bool {
+	sections := func(c *config.Config) []interface{} {
+		return []interface{}{c.CloudWatch, c.GRPC, c.Quickwit, c.VictoriaLogs, c.Vector, c.S3, c.GCP, c.Azure, c.Sentry, c.XRay, c.SES, c.PagerDuty, c.Summary.DedupeWindow, c.Retry}
+	}
+	return !reflect.DeepEqual(sections(current), sections(next))
+}
+
+// AWS configuration of the CloudWatch Logs client, which may deliver to another region or,
+// through an assumed role, another account
+func cloudWatchConfig(cfg aws.Config, settings config.CloudWatch) aws.Config {
+	cfg = cfg.Copy()
+	if settings.Region != "" {
+		cfg.Region = settings.Region
+	}
+	if settings.RoleArn != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), settings.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "sst-extension"
+			if settings.ExternalID != "" {
+				o.ExternalID = aws.String(settings.ExternalID)
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return cfg
+}
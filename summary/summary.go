@@ -0,0 +1,166 @@
+package summary
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Structured record describing one invocation, emitted after its REPORT line
+type Record struct {
+	Type       string    `json:"type"`
+	RequestID  string    `json:"requestId"`
+	Status     string    `json:"status,omitempty"`
+	ErrorType  string    `json:"errorType,omitempty"`
+	DurationMs float64   `json:"durationMs"`
+	Group      string    `json:"logGroup"`
+	Stream     string    `json:"logStream"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	LogURL     string    `json:"logUrl,omitempty"`
+	// Step Functions execution the invocation is part of
+	ExecutionArn string `json:"executionArn,omitempty"`
+	StateName    string `json:"stateName,omitempty"`
+	// SHA-256 of the invocation payload, to spot duplicate deliveries
+	PayloadHash string `json:"payloadHash,omitempty"`
+	// Telemetry records the platform dropped while the invocation ran, and why
+	DroppedRecords int64    `json:"droppedRecords,omitempty"`
+	DroppedReasons []string `json:"droppedReasons,omitempty"`
+	// From platform.runtimeDone
+	ProducedBytes int64  `json:"producedBytes,omitempty"`
+	TraceID       string `json:"traceId,omitempty"`
+	Spans         []Span `json:"spans,omitempty"`
+	// Set on the first invocation of a sandbox
+	Init *Init `json:"init,omitempty"`
+}
+
+// A phase of the invocation as timed by the platform, e.g. responseLatency
+type Span struct {
+	Name       string  `json:"name"`
+	Start      string  `json:"start"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+// Outcome of the sandbox initialization, from platform.initReport
+type Init struct {
+	Type       string  `json:"type"`
+	Phase      string  `json:"phase"`
+	Status     string  `json:"status"`
+	ErrorType  string  `json:"errorType,omitempty"`
+	DurationMs float64 `json:"durationMs"`
+	Spans      []Span  `json:"spans,omitempty"`
+}
+
+const recordType = "sst.summary"
+
+func New(requestID string) *Record {
+	return &Record{
+		Type:      recordType,
+		RequestID: requestID,
+	}
+}
+
+// Points the log link at the given group, stream and time range
+func (r *Record) Link(region string, group string, stream string, start time.Time, end time.Time) {
+	r.Group = group
+	r.Stream = stream
+	r.Start = start
+	r.End = end
+	r.LogURL = ConsoleURL(region, group, stream, start, end)
+}
+
+// Renders the record as the single JSON line written to the destination
+func (r *Record) String() string {
+	data, _ := json.Marshal(r)
+	return string(data)
+}
+
+// Identifies REPORT and summary lines by kind and invocation, so a line describing the
+// same invocation twice can be recognized. Returns an empty key for any other line.
+func Key(message string) string {
+	if rest, ok := strings.CutPrefix(message, "REPORT RequestId: "); ok {
+		requestID, _, _ := strings.Cut(rest, "\t")
+		return "report:" + strings.TrimSpace(requestID)
+	}
+	if !strings.HasPrefix(message, `{"type":"`+recordType+`"`) {
+		return ""
+	}
+	var record Record
+	if json.Unmarshal([]byte(message), &record) != nil {
+		return ""
+	}
+	return "summary:" + record.RequestID
+}
+
+// Builds a CloudWatch console link to the stream, limited to the given time range
+func ConsoleURL(region string, group string, stream string, start time.Time, end time.Time) string {
+	query := fmt.Sprintf("?start=%d&end=%d", start.UnixMilli(), end.UnixMilli())
+	return fmt.Sprintf(
+		"https://%s.console.aws.amazon.com/cloudwatch/home?region=%s#logsV2:log-groups/log-group/%s/log-events/%s%s",
+		region,
+		region,
+		consoleEscape(group),
+		consoleEscape(stream),
+		strings.ReplaceAll(escapeComponent(query), "%", "$"),
+	)
+}
+
+// Path segments of the console fragment are escaped twice and use $ in place of %
+func consoleEscape(value string) string {
+	return strings.ReplaceAll(escapeComponent(escapeComponent(value)), "%", "$")
+}
+
+// Escapes like JavaScript's encodeURIComponent, which the console expects
+func escapeComponent(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+// Keeps copies of the most recent records so they can be looked up by request id
+// while the invoke loop keeps updating its own
+type Recent struct {
+	mu      sync.Mutex
+	size    int
+	order   []string
+	records map[string]Record
+}
+
+func NewRecent(size int) *Recent {
+	return &Recent{
+		size:    size,
+		records: map[string]Record{},
+	}
+}
+
+// Stores a copy of the record, replacing an earlier one for the same request
+func (r *Recent) Add(record Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.records[record.RequestID]; !ok {
+		r.order = append(r.order, record.RequestID)
+	}
+	r.records[record.RequestID] = record
+	for len(r.order) > r.size {
+		delete(r.records, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+func (r *Recent) Get(requestID string) (Record, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.records[requestID]
+	return record, ok
+}
+
+// Returns the record added last
+func (r *Recent) Latest() (Record, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.order) == 0 {
+		return Record{}, false
+	}
+	return r.records[r.order[len(r.order)-1]], true
+}
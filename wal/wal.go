@@ -0,0 +1,210 @@
+package wal
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/sst/extension/sink"
+)
+
+// File the /tmp segment is kept in, inside Options.Dir
+const segmentFile = "wal.json"
+
+// A batch waiting to be delivered, numbered in the order it was appended
+type Record struct {
+	Seq   uint64     `json:"seq"`
+	Batch sink.Batch `json:"batch"`
+}
+
+type Options struct {
+	// Directory of the /tmp segment. Empty keeps the log in memory only
+	Dir string
+	// Maximum number of undelivered batches, the oldest are dropped beyond it. Zero for unlimited
+	MaxBatches int
+}
+
+// Write-ahead log sitting between building batches and delivering them.
+//
+// Every consumer, normally one per sink, reads the batches it hasn't acknowledged yet
+// in order and acknowledges them once written, so a failing sink neither loses batches
+// nor holds back the others. Batches stay in the memory segment until every consumer
+// acknowledged them; Sync mirrors what is left to the /tmp segment, which Open reads
+// back when the extension restarts within the same sandbox.
+type Log struct {
+	mu         sync.Mutex
+	dir        string
+	maxBatches int
+	next       uint64
+	records    []Record
+	cursors    map[string]uint64
+	consumers  []string
+}
+
+type segment struct {
+	Next    uint64            `json:"next"`
+	Cursors map[string]uint64 `json:"cursors"`
+	Records []Record          `json:"records"`
+}
+
+// Opens the log for the given consumers, recovering the /tmp segment if there is one
+func Open(options Options, consumers []string) (*Log, error) {
+	l := &Log{
+		dir:        options.Dir,
+		maxBatches: options.MaxBatches,
+		next:       1,
+		cursors:    map[string]uint64{},
+		consumers:  consumers,
+	}
+	if l.dir == "" {
+		return l, nil
+	}
+	if err := os.MkdirAll(l.dir, 0o700); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(l.dir, segmentFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var recovered segment
+	if err := json.Unmarshal(data, &recovered); err != nil {
+		// A torn write, start over rather than failing to initialize
+		log.Println("[wal:Open] Discarding unreadable segment:", err)
+		return l, nil
+	}
+	l.next = max(recovered.Next, 1)
+	l.records = recovered.Records
+	for name, seq := range recovered.Cursors {
+		l.cursors[name] = seq
+	}
+	log.Println("[wal:Open] Recovered", len(l.records), "batches")
+	return l, nil
+}
+
+// Adds a batch, returning its sequence number
+func (l *Log) Append(batch sink.Batch) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	seq := l.next
+	l.next++
+	l.records = append(l.records, Record{Seq: seq, Batch: batch})
+	if l.maxBatches > 0 && len(l.records) > l.maxBatches {
+		dropped := len(l.records) - l.maxBatches
+		log.Println("[wal:Append] Queue full, dropping", dropped, "undelivered batches")
+		l.records = l.records[dropped:]
+	}
+	return seq
+}
+
+// Batches the consumer hasn't acknowledged yet, oldest first
+func (l *Log) Pending(consumer string) []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cursor := l.cursors[consumer]
+	pending := []Record{}
+	for _, record := range l.records {
+		if record.Seq > cursor {
+			pending = append(pending, record)
+		}
+	}
+	return pending
+}
+
+// Marks every batch up to seq as delivered to the consumer. Batches every consumer
+// acknowledged are released.
+func (l *Log) Ack(consumer string, seq uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if seq > l.cursors[consumer] {
+		l.cursors[consumer] = seq
+	}
+	released := l.next - 1
+	for _, name := range l.consumers {
+		released = min(released, l.cursors[name])
+	}
+	kept := l.records[:0]
+	for _, record := range l.records {
+		if record.Seq > released {
+			kept = append(kept, record)
+		}
+	}
+	l.records = kept
+}
+
+// Replaces the consumers, e.g. after the sinks were rebuilt. Consumers that remain keep
+// their position, new ones only receive batches appended from now on. Batches only the
+// removed consumers were waiting for are released.
+func (l *Log) SetConsumers(consumers []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	kept := map[string]uint64{}
+	for _, name := range consumers {
+		if cursor, ok := l.cursors[name]; ok || slices.Contains(l.consumers, name) {
+			kept[name] = cursor
+		} else {
+			kept[name] = l.next - 1
+		}
+	}
+	l.cursors = kept
+	l.consumers = consumers
+	released := l.next - 1
+	for _, name := range l.consumers {
+		released = min(released, l.cursors[name])
+	}
+	records := l.records[:0]
+	for _, record := range l.records {
+		if record.Seq > released {
+			records = append(records, record)
+		}
+	}
+	l.records = records
+}
+
+// Returns every batch some consumer hasn't acknowledged yet
+func (l *Log) Records() []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Record{}, l.records...)
+}
+
+// Number of batches not yet acknowledged by every consumer
+func (l *Log) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.records)
+}
+
+// Mirrors the undelivered batches to the /tmp segment, removing it once everything
+// was delivered. Does nothing for memory only logs.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dir == "" {
+		return nil
+	}
+	path := filepath.Join(l.dir, segmentFile)
+	if len(l.records) == 0 {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	data, err := json.Marshal(segment{Next: l.next, Cursors: l.cursors, Records: l.records})
+	if err != nil {
+		return err
+	}
+	// Written next to the segment and renamed over it so a crash never leaves half a file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}